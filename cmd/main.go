@@ -1,8 +1,19 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
 	db "accelerator/internal/db"
+	"accelerator/internal/mailer"
 	"accelerator/internal/mediaworker"
+	"accelerator/internal/password"
 	"accelerator/internal/server"
 	"accelerator/internal/sessioncash"
 	"accelerator/logging"
@@ -20,21 +31,123 @@ func main() {
 	logger := logging.SetupLogging(conf.LogPath, conf.LogLevel)
 	logger.Infoln("Here we go")
 	worker := mediaworker.NewMediaWorker(conf.MediaDir)
-	dconn := db.NewDb(conf.DbPath, worker, logger)
-	err = dconn.CreateTables()
+	hashers := password.Hashers{
+		Current: password.NewArgon2id(conf.Argon2Time, conf.Argon2Memory, conf.Argon2Threads),
+		Legacy:  []password.Hasher{&password.Bcrypt{}},
+	}
+	var users db.UserRepository
+	var brands db.BrandRepository
+	if conf.Storage == "memory" {
+		if len(os.Args) > 1 && os.Args[1] == "migrate" {
+			log.Fatal("migrations are only for postgres storage")
+		}
+		mem := db.NewMemoryRepository(&hashers)
+		users, brands = mem, mem
+	} else {
+		dconn := db.NewDb(conf.DbPath, worker, &hashers, logger)
+		// `accelerator migrate up|down [n]|status` only touches the schema and exits
+		if len(os.Args) > 1 && os.Args[1] == "migrate" {
+			err = migrate(&dconn, os.Args[2:])
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		_, err = dconn.MigrateUp(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+		if conf.PurgeEverySec > 0 {
+			go dconn.RunPurge(context.Background(), time.Duration(conf.PurgeEverySec)*time.Second, time.Duration(conf.DeletedRetentionSec)*time.Second)
+		}
+		users, brands = &dconn, &dconn
+	}
+	conf.VerifySecret, err = verifySecret(conf.VerifySecret, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cashDb, err := newCashDb(conf)
 	if err != nil {
 		log.Fatal(err)
 	}
-	cashDb, err := sessioncash.NewTarantoolCashDB(conf.SessionCashPath, conf.CashUser, conf.CashPassword, "sessions", tarantool.Opts{
-		Reconnect: 10, MaxReconnects: 3,
-	})
+	mail, err := mailer.NewMailer(conf.Mailer, conf.MailOutbox, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s := server.NewServer(users, brands, cashDb, mail, logger, conf)
+	err = s.PromoteAdmins(context.Background())
 	if err != nil {
 		log.Fatal(err)
 	}
-	s := server.NewServer(&dconn, cashDb, logger, conf.SessionLenSec)
 	s.SetupRouting()
 	err = s.ListenAndServe(conf.Port)
 	if err != nil {
 		log.Errorln(err)
 	}
 }
+
+// verifySecret whoever knows the secret can verify any email, so a guessable one is as good as none.
+// Without one, a random secret is made for this run only, which is enough for trying things out
+func verifySecret(secret string, logger *log.Logger) (string, error) {
+	if secret == "" {
+		key := make([]byte, 32)
+		_, err := rand.Read(key)
+		if err != nil {
+			return "", err
+		}
+		logger.Warnln("verification_secret is not set, using a random one: verification links will stop working after a restart")
+		return hex.EncodeToString(key), nil
+	}
+	if secret == "change-me" || len(secret) < 32 {
+		return "", errors.New("verification_secret has to be at least 32 random bytes, or left empty for a temporary one")
+	}
+	return secret, nil
+}
+
+func newCashDb(conf config.Config) (sessioncash.CashDb, error) {
+	switch conf.SessionBackend {
+	case "memory":
+		return sessioncash.NewMemoryCashDB(context.Background(), time.Duration(conf.SweepEverySec)*time.Second), nil
+	default:
+		return sessioncash.NewTarantoolCashDB(conf.SessionCashPath, conf.CashUser, conf.CashPassword, "sessions", tarantool.Opts{
+			Reconnect: 10, MaxReconnects: 3,
+		})
+	}
+}
+
+func migrate(d *db.Database, args []string) error {
+	ctx := context.Background()
+	if len(args) == 0 {
+		return errors.New("usage: migrate up|down [n]|status")
+	}
+	switch args[0] {
+	case "up":
+		n, err := d.MigrateUp(ctx)
+		fmt.Printf("applied %d migrations\n", n)
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return errors.New("down takes a positive number of migrations to revert")
+			}
+		}
+		n, err := d.MigrateDown(ctx, steps)
+		fmt.Printf("reverted %d migrations\n", n)
+		return err
+	case "status":
+		all, err := d.MigrationStatus(ctx)
+		for _, m := range all {
+			applied := "pending"
+			if m.AppliedAt != nil {
+				applied = m.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d %-30s %s\n", m.Version, m.Name, applied)
+		}
+		return err
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
@@ -8,15 +8,43 @@ import (
 )
 
 type Config struct {
+	Storage         string `yaml:"storage"` // "postgres" (default) or "memory", which forgets everything on restart
 	DbPath          string `yaml:"db_path"`
 	LogPath         string `yaml:"log_path"`
 	LogLevel        string `yaml:"log_level"`
 	SessionLenSec   int64  `yaml:"session_len"`
+	SessionMaxSec   int64  `yaml:"session_max_len"` // sessions slide by session_len, but never live longer than this; 0 turns sliding off
 	Port            string `yaml:"port"`
 	SessionCashPath string `yaml:"session_cash_path"`
 	CashUser        string `yaml:"cash_user"`
 	CashPassword    string `yaml:"cash_password"`
 	MediaDir        string `yaml:"media_dir"`
+	SessionBackend  string `yaml:"session_backend"` // "tarantool" (default) or "memory"
+	SweepEverySec   int64  `yaml:"session_sweep_interval"`
+	// failed logins are counted per email and per ip; after the threshold the key is locked, and every next failure doubles the lock
+	LoginMaxAttempts   int   `yaml:"login_max_attempts"` // 0 turns the protection off
+	LoginMaxIpAttempts int   `yaml:"login_max_ip_attempts"`
+	LoginWindowSec     int64 `yaml:"login_window"`
+	LoginLockoutSec    int64 `yaml:"login_lockout"`
+	LoginMaxLockoutSec int64 `yaml:"login_max_lockout"`
+	// argon2id parameters for new password hashes, zeroes mean the OWASP minimum. Old hashes are upgraded on login
+	Argon2Time    uint32 `yaml:"argon2_time"`
+	Argon2Memory  uint32 `yaml:"argon2_memory"` // KiB
+	Argon2Threads uint8  `yaml:"argon2_threads"`
+	Mailer        string `yaml:"mailer"` // "log" (default) or "file"
+	MailOutbox    string `yaml:"mail_outbox"`
+	PublicUrl     string `yaml:"public_url"` // where links in emails lead
+	ResetLenSec   int64  `yaml:"reset_token_len"`
+	VerifySecret  string `yaml:"verification_secret"` // signs email verification links
+	VerifyLenSec  int64  `yaml:"verification_len"`
+	ResendMax     int    `yaml:"verification_resend_max"` // resends per login_window before they get locked like failed logins
+	// deleted brands can be restored for deleted_retention, then they are purged with their images; 0 purge_interval turns purging off
+	DeletedRetentionSec int64 `yaml:"deleted_retention"`
+	PurgeEverySec       int64 `yaml:"purge_interval"`
+	// every request gets query_timeout for all of its postgres and session cash calls, after that it fails with 504; 0 turns it off
+	QueryTimeoutSec int64 `yaml:"query_timeout"`
+	// these emails get the admin role at startup, or when they are verified if they register later. Only verified accounts are promoted
+	Admins []string `yaml:"admins"`
 }
 
 func ParseConfig(path string) (Config, error) {
@@ -4,14 +4,16 @@ go 1.20
 
 require (
 	github.com/gofiber/fiber/v2 v2.51.0
+	github.com/google/uuid v1.4.0
 	github.com/lib/pq v1.10.9
 	github.com/sirupsen/logrus v1.9.3
+	github.com/tarantool/go-tarantool/v2 v2.0.0-20231130085242-cabe16e8ee52
+	golang.org/x/crypto v0.16.0
 	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
 
 require (
 	github.com/andybalholm/brotli v1.0.5 // indirect
-	github.com/google/uuid v1.4.0 // indirect
 	github.com/klauspost/compress v1.16.7 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
@@ -21,12 +23,10 @@ require (
 	github.com/spacemonkeygo/spacelog v0.0.0-20180420211403-2296661a0572 // indirect
 	github.com/tarantool/go-iproto v0.1.1-0.20231025103136-cb7894473931 // indirect
 	github.com/tarantool/go-openssl v0.0.8-0.20231004103608-336ca939d2ca // indirect
-	github.com/tarantool/go-tarantool/v2 v2.0.0-20231130085242-cabe16e8ee52 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/valyala/fasthttp v1.50.0 // indirect
 	github.com/valyala/tcplisten v1.0.0 // indirect
 	github.com/vmihailenco/msgpack/v5 v5.3.5 // indirect
 	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
-	golang.org/x/crypto v0.16.0 // indirect
 	golang.org/x/sys v0.15.0 // indirect
 )
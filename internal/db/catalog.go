@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"accelerator/models"
+)
+
+var ERRBADSORT = errors.New("unknown sort order")
+
+// brandSort expr is what brands are ordered by, cast turns its text form from the cursor back into the same type
+type brandSort struct {
+	expr string
+	cast string
+	desc bool
+}
+
+const latestStatValue = `(SELECT s.value FROM statistics s WHERE s.brand_id = b.id ORDER BY s.end_time DESC NULLS LAST, s.id DESC LIMIT 1)`
+
+var brandSorts = map[string]brandSort{
+	"":         {expr: "b.id", cast: "::int"},
+	"name":     {expr: "coalesce(b.name, '')", cast: "::text"},
+	"-name":    {expr: "coalesce(b.name, '')", cast: "::text", desc: true},
+	"created":  {expr: "b.created_at", cast: "::timestamptz"},
+	"-created": {expr: "b.created_at", cast: "::timestamptz", desc: true},
+	// brands without statistics go last in descending order and first in ascending
+	"stat":  {expr: "coalesce(" + latestStatValue + "::float8, '-Infinity')", cast: "::float8"},
+	"-stat": {expr: "coalesce(" + latestStatValue + "::float8, '-Infinity')", cast: "::float8", desc: true},
+}
+
+// queryArgs collects arguments and hands out their $n placeholders
+type queryArgs struct {
+	args []interface{}
+}
+
+func (a *queryArgs) add(v interface{}) string {
+	a.args = append(a.args, v)
+	return "$" + strconv.Itoa(len(a.args))
+}
+
+// brandConditions builds the WHERE part for the brand aliased as b. Facets skip their own filter, so that the other options still get counted
+func brandConditions(f *models.BrandFilter, a *queryArgs, skip string) string {
+	conds := []string{"b.status = 'published'", "b.deleted_at IS NULL"}
+	if f.City != "" && skip != "city" {
+		conds = append(conds, "lower(b.city) = lower("+a.add(f.City)+")")
+	}
+	// price filters are about one product: it has to be in this currency and its range has to overlap the wanted one
+	var price []string
+	if f.PriceMin != nil {
+		price = append(price, "pr.high_end >= "+a.add(*f.PriceMin))
+	}
+	if f.PriceMax != nil {
+		price = append(price, "pr.low_end <= "+a.add(*f.PriceMax))
+	}
+	if f.Currency != "" && skip != "currency" {
+		price = append(price, "pr.currency = "+a.add(f.Currency))
+	}
+	if len(price) > 0 {
+		conds = append(conds, "EXISTS (SELECT 1 FROM products p JOIN prices pr ON pr.id = p.price_id WHERE p.brand_id = b.id AND "+strings.Join(price, " AND ")+")")
+	}
+	for _, contact := range f.Contacts {
+		conds = append(conds, "EXISTS (SELECT 1 FROM l_brand_contacts l JOIN contacts c ON c.id = l.contact_id WHERE l.brand_id = b.id AND c.type = "+a.add(contact)+")")
+	}
+	if f.HasStats != nil {
+		stats := "EXISTS (SELECT 1 FROM statistics s WHERE s.brand_id = b.id)"
+		if !*f.HasStats {
+			stats = "NOT " + stats
+		}
+		conds = append(conds, stats)
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// GetOpenBrands gives at most limit open brands matching the filter, in its sort order, starting after the cursor (zero cursor is the first page).
+// next is where the following page starts, nil if this one is the last
+func (d *Database) GetOpenBrands(c context.Context, f *models.BrandFilter, after models.BrandCursor, limit int) (open []models.Brand, next *models.BrandCursor, err error) {
+	sort, ok := brandSorts[f.Sort]
+	if !ok {
+		return nil, nil, ERRBADSORT
+	}
+	a := &queryArgs{}
+	where := brandConditions(f, a, "")
+	cmp, order := ">", ""
+	if sort.desc {
+		cmp, order = "<", " DESC"
+	}
+	if after.Id > 0 {
+		key := after.Key
+		if f.Sort == "" {
+			key = strconv.Itoa(after.Id)
+		}
+		where += " AND (" + sort.expr + ", b.id) " + cmp + " (" + a.add(key) + sort.cast + ", " + a.add(after.Id) + "::int)"
+	}
+	getOpen := `SELECT b.id, (` + sort.expr + `)::text FROM brands b WHERE ` + where +
+		` ORDER BY ` + sort.expr + order + `, b.id` + order + ` LIMIT ` + a.add(limit+1) // one extra id is cheap, one extra brand is not
+	rows, err := d.db.QueryContext(c, getOpen, a.args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var cursors []models.BrandCursor
+	for rows.Next() {
+		var cur models.BrandCursor
+		err = rows.Scan(&cur.Id, &cur.Key)
+		if err != nil {
+			return nil, nil, err
+		}
+		cursors = append(cursors, cur)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(cursors) > limit {
+		cursors = cursors[:limit]
+		next = &cursors[limit-1]
+	}
+	ids := make([]int, len(cursors))
+	for i, cur := range cursors {
+		ids[i] = cur.Id
+	}
+	open, err = d.GetBrandsByIds(c, ids, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return open, next, nil
+}
+
+func (d *Database) CountOpenBrands(c context.Context, f *models.BrandFilter) (int, error) {
+	a := &queryArgs{}
+	var res int
+	err := d.db.QueryRowContext(c, `SELECT count(*) FROM brands b WHERE `+brandConditions(f, a, ""), a.args...).Scan(&res)
+	return res, err
+}
+
+// GetBrandFacets counts matching brands per city and per currency of their products
+func (d *Database) GetBrandFacets(c context.Context, f *models.BrandFilter) (models.Facets, error) {
+	var res models.Facets
+	a := &queryArgs{}
+	byCity := `SELECT coalesce(b.city, ''), count(*) FROM brands b WHERE ` + brandConditions(f, a, "city") + ` GROUP BY 1 ORDER BY 2 DESC, 1`
+	cities, err := d.collectFacets(c, byCity, a.args)
+	if err != nil {
+		return res, err
+	}
+	a = &queryArgs{}
+	byCurrency := `SELECT coalesce(pr.currency, ''), count(DISTINCT b.id) FROM brands b JOIN products p ON p.brand_id = b.id JOIN prices pr ON pr.id = p.price_id
+		WHERE ` + brandConditions(f, a, "currency") + ` GROUP BY 1 ORDER BY 2 DESC, 1`
+	currencies, err := d.collectFacets(c, byCurrency, a.args)
+	if err != nil {
+		return res, err
+	}
+	res.Cities, res.Currencies = cities, currencies
+	return res, nil
+}
+
+func (d *Database) collectFacets(c context.Context, query string, args []interface{}) ([]models.FacetCount, error) {
+	rows, err := d.db.QueryContext(c, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	res := []models.FacetCount{}
+	for rows.Next() {
+		var fc models.FacetCount
+		err = rows.Scan(&fc.Value, &fc.Count)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, fc)
+	}
+	return res, rows.Err()
+}
@@ -4,282 +4,145 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"strconv"
-	"strings"
 
 	fileWorker "accelerator/internal/mediaworker"
+	"accelerator/internal/password"
 	"accelerator/models"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/crypto/bcrypt"
 )
 
-const BcryptCost = 5
-
 var ERRNOPERM = errors.New("this user doesn't have permission to update")
+var ERRSTALE = errors.New("brand was changed by someone else")
 
 type Database struct {
 	db         *sql.DB
 	fileWorker fileWorker.MediaWorker
+	hashers    *password.Hashers
 	log        *log.Logger
 }
 
-func NewDb(dsn string, worker fileWorker.MediaWorker, log *log.Logger) Database {
+// IsQueryCanceled postgres stopped the statement: its statement_timeout ran out, or the context of the query was done and pq
+// asked it to stop. pq gives its own error for that, not the context's
+func IsQueryCanceled(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "57014" // query_canceled
+}
+
+func NewDb(dsn string, worker fileWorker.MediaWorker, hashers *password.Hashers, log *log.Logger) Database {
 	conn, err := sql.Open("postgres", dsn)
 	if err != nil {
 		log.Errorln(err)
 		return Database{}
 	}
-	return Database{db: conn, fileWorker: worker, log: log}
+	return Database{db: conn, fileWorker: worker, hashers: hashers, log: log}
 }
 
-func (d *Database) CreateTables() error {
-	createBrand := `CREATE TABLE IF NOT EXISTS Brands(id SERIAL PRIMARY KEY, name VARCHAR(50) UNIQUE, DESCRIPTION VARCHAR(200), city VARCHAR(50), is_open BOOLEAN, added_by INT, constraint fk_user_id FOREIGN KEY (added_by) REFERENCES users(id) ON DELETE SET NULL)`
-	createStats := `CREATE TABLE IF NOT EXISTS Statistics(id SERIAL PRIMARY KEY, start_time DATE, end_time DATE, name VARCHAR(50), description VARCHAR(200), value NUMERIC, brand_id INT, CONSTRAINT fk_statistics FOREIGN KEY(brand_id) REFERENCES Brands(id) ON DELETE CASCADE)`
-	createPrices := `CREATE TABLE IF NOT EXISTS Prices(id SERIAL PRIMARY KEY, low_end INT, high_end INT, currency VARCHAR(20))`
-	createProducts := `CREATE TABLE IF NOT EXISTS Products(id SERIAL PRIMARY KEY, name VARCHAR(50) UNIQUE, description VARCHAR(50), price_id INT, brand_id INT, CONSTRAINT fk_price_product FOREIGN KEY(price_id) REFERENCES Prices(id) ON DELETE CASCADE, CONSTRAINT fk_brand_product FOREIGN KEY(brand_id) REFERENCES Brands(id) ON DELETE CASCADE)`
-	createContacts := `CREATE TABLE IF NOT EXISTS Contacts(id SERIAL PRIMARY KEY, type VARCHAR(20), contact VARCHAR(100))`
-	createLinkCBrand := `CREATE TABLE IF NOT EXISTS L_Brand_Contacts(id SERIAL PRIMARY KEY, brand_id INT, contact_id INT, CONSTRAINT fk_link_contacts FOREIGN KEY(brand_id) REFERENCES Brands(id) ON DELETE CASCADE, CONSTRAINT fk_contact_id FOREIGN KEY(contact_id) REFERENCES Contacts(id) ON DELETE CASCADE)`
-	createHistory := `CREATE TABLE IF NOT EXISTS History(id SERIAL PRIMARY KEY)` // TBD LATER
-	createOwners := `CREATE TABLE IF NOT EXISTS Owners(id SERIAL PRIMARY KEY, name VARCHAR(20), surname VARCHAR(50), fathername VARCHAR(50), bio_info VARCHAR(200), history_id INT, CONSTRAINT fk_history_id FOREIGN KEY (history_id) REFERENCES History(id))`
-	createLOBrand := `CREATE TABLE IF NOT EXISTS L_Brand_Owners(id SERIAL PRIMARY KEY, brand_id INT, owner_id INT, CONSTRAINT fk_link_owners FOREIGN KEY(brand_id) REFERENCES Brands(id) ON DELETE CASCADE, CONSTRAINT fk_owner_id FOREIGN KEY(owner_id) REFERENCES Owners(id) ON DELETE CASCADE)`
-	createUsers := `CREATE TABLE IF NOT EXISTS users(id SERIAL PRIMARY KEY, email VARCHAR(50) UNIQUE, password VARCHAR(200), name VARCHAR(50), surname VARCHAR(50))`
-	createMedia := `CREATE TABLE IF NOT EXISTS media(id SERIAL PRIMARY KEY, path varchar(50), product_id INT, CONSTRAINT fk_photo_product FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE)`
-	execList := []string{
-		createUsers,
-		createBrand, createStats, createPrices, createProducts, createContacts, createLinkCBrand, createHistory,
-		createOwners,
-		createLOBrand,
-		createMedia,
-	}
-	for _, st := range execList {
-		_, err := d.db.Exec(st)
-		if err != nil {
-			return err
-		}
+func (d *Database) GetBrandIdByName(c context.Context, name string) (int, error) { // works because names are unique (see table definitions)
+	var res int
+	err := d.db.QueryRowContext(c, `SELECT id FROM brands WHERE name = $1 AND deleted_at IS NULL`, name).Scan(&res)
+	if errors.Is(err, sql.ErrNoRows) {
+		return -1, nil
 	}
-	return nil
+	return res, err
 }
 
-func (d *Database) getBrandOwners(brandId int) ([]models.Owner, error) {
-	getOwnerIds := `SELECT owner_id FROM l_brand_owners WHERE brand_id = $1`
-	getOwnerById := `SELECT name, surname, fathername, bio_info FROM owners WHERE id = $1` // email is not meant to be publicly visible
-	rows, err := d.db.Query(getOwnerIds, brandId)
-	if err != nil {
-		return nil, err
-	}
-	var res []models.Owner
-	for rows.Next() {
-		id := 0
-		err = rows.Scan(&id)
-		if err != nil {
-			return nil, err
-		}
-		owner, err := d.db.Query(getOwnerById, id)
-		if err != nil {
-			return nil, err
-		}
-		cur := models.Person{}
-		for owner.Next() {
-			err = owner.Scan(&cur.Name, &cur.Surname, &cur.Fathername, &cur.BioInfo)
-			if err != nil {
-				return nil, err
-			}
-		}
-		err = owner.Close()
-		if err != nil {
-			return nil, err
-		}
-		res = append(res, models.NewOwner(&cur))
-	}
-	err = rows.Close()
-	if err != nil {
-		return res, err
-	}
-	return res, nil
+func (d *Database) GetBrandById(c context.Context, id int) (models.Brand, error) {
+	return d.getBrand(c, id, true)
+}
+
+// GetBrandForEdit same as GetBrandById, but products come without images, so nothing is read from disk.
+// UpdateBrand leaves images of such products alone
+func (d *Database) GetBrandForEdit(c context.Context, id int) (models.Brand, error) {
+	return d.getBrand(c, id, false)
 }
 
-func (d *Database) getBrandContacts(brandId int) ([]models.Contact, error) {
-	getContactIds := `SELECT contact_id FROM l_brand_contacts WHERE brand_id = $1`
-	getContactById := `SELECT type, contact FROM contacts WHERE id = $1`
-	rows, err := d.db.Query(getContactIds, brandId)
+func (d *Database) getBrand(c context.Context, id int, withMedia bool) (models.Brand, error) {
+	res, err := d.GetBrandsByIds(c, []int{id}, withMedia)
 	if err != nil {
-		return nil, err
+		return models.Brand{}, err
 	}
-	var res []models.Contact
-	for rows.Next() {
-		id := 0
-		err = rows.Scan(&id)
-		if err != nil {
-			return nil, err
-		}
-		contact, err := d.db.Query(getContactById, id)
-		if err != nil {
-			return nil, err
-		}
-		var curtype string
-		var curlink string
-		for contact.Next() {
-			err = contact.Scan(&curtype, &curlink)
-			if err != nil {
-				return nil, err
-			}
-		}
-		err = contact.Close()
-		if err != nil {
-			return nil, err
-		}
-		res = append(res, models.NewContact(curtype, curlink))
+	if len(res) == 0 {
+		return models.Brand{}, sql.ErrNoRows
 	}
-	err = rows.Close()
+	return res[0], nil
+}
+
+func (d *Database) CreateUser(c context.Context, u models.User) error {
+	insertUser := `INSERT INTO users(email, password, name, surname, verified_at) VALUES ($1, $2, $3, $4, NULL)` // new accounts have to confirm the email
+	passwd, err := d.hashers.Hash(u.Password)
 	if err != nil {
-		return res, err
+		return err
 	}
-	return res, nil
+	_, err = d.db.ExecContext(c, insertUser, u.Email, passwd, u.Name, u.Surname)
+	return err
 }
 
-func (d *Database) GetBrandIdByName(name string) (int, error) { // works because names are unique (see table definitions)
-	var res int
-	err := d.db.QueryRow(`SELECT id FROM brands WHERE name = $1`, name).Scan(&res)
+func (d *Database) IsVerified(c context.Context, mail string) (bool, error) {
+	var verified bool
+	getVerified := `SELECT verified_at IS NOT NULL FROM users WHERE email = $1`
+	err := d.db.QueryRowContext(c, getVerified, mail).Scan(&verified)
 	if errors.Is(err, sql.ErrNoRows) {
-		return -1, nil
+		return false, ERRNOUSER
 	}
-	return res, err
+	return verified, err
 }
 
-func (d *Database) GetBrandById(id int) (models.Brand, error) {
-	var res models.Brand
-	getCore := `SELECT name, description, city FROM brands WHERE id = $1`
-	getProducts := `SELECT id, name, description, price_id FROM products WHERE brand_id = $1`
-	getStats := `SELECT id, name, description, start_time, end_time, value FROM statistics WHERE brand_id = $1`
-	getPrice := `SELECT low_end, high_end, currency FROM prices WHERE id = $1`
-	getMedia := `SELECT path FROM media WHERE product_id = $1`
-	// get core info first
-	err := d.db.QueryRow(getCore, id).Scan(&res.Name, &res.Description, &res.Location)
-	if err != nil {
-		return res, err
-	}
-	// search for products
-	rows, err := d.db.Query(getProducts, id)
-	if err != nil {
-		return res, err
-	}
-	curPrice := models.Price{}
-	for rows.Next() {
-		p := models.Product{}
-		err = rows.Scan(&p.Id, &p.Name, &p.Description, &p.Price.Id)
-		if err != nil {
-			return res, err
-		}
-		err = d.db.QueryRow(getPrice, p.Price.Id).Scan(&curPrice.LowEnd, &curPrice.HighEnd, &curPrice.Currency)
-		if err != nil {
-			return res, err
-		}
-		p.Price.LowEnd = curPrice.LowEnd
-		p.Price.HighEnd = curPrice.HighEnd
-		p.Price.Currency = curPrice.Currency
-		// query for media with same product_id
-		rowsMedia, err := d.db.Query(getMedia, p.Id)
-		if err != nil {
-			return res, err
-		}
-		for rowsMedia.Next() {
-			var path string
-			err = rowsMedia.Scan(&path)
-			if err != nil {
-				_ = rowsMedia.Close()
-				return res, err
-			}
-			// fetch file from dist
-			file, err := d.fileWorker.LoadFile(path)
-			if err != nil {
-				_ = rowsMedia.Close()
-				return res, err
-			}
-			p.Media = append(p.Media, "data:image/jpeg;base64,"+fileWorker.ImageToString(file))
-		}
-		_ = rowsMedia.Close()
-		// add one by one
-		res.AppendProduct(p)
-	}
-	err = rows.Close()
-	if err != nil {
-		return res, err
-	}
-	// add owners info
-	owners, err := d.getBrandOwners(id)
-	if err != nil {
-		return res, err
-	}
-	res.AppendOwner(owners...)
-	// add contacts info
-	contacts, err := d.getBrandContacts(id)
+// SetVerified verifying twice keeps the first time
+func (d *Database) SetVerified(c context.Context, mail string) error {
+	setVerified := `UPDATE users SET verified_at = COALESCE(verified_at, now()) WHERE email = $1`
+	res, err := d.db.ExecContext(c, setVerified, mail)
 	if err != nil {
-		return res, err
+		return err
 	}
-	res.AppendContact(contacts...)
-	// search for stat info
-	rows, err = d.db.Query(getStats, id)
+	n, err := res.RowsAffected()
 	if err != nil {
-		return res, err
-	}
-	for rows.Next() {
-		stat := models.StatisticMeasure{}
-		err := rows.Scan(&stat.Id, &stat.Name, &stat.Description, &stat.StartPeriod, &stat.EndPeriod, &stat.Value)
-		if err != nil {
-			return res, err
-		}
-		// add one by one
-		res.AppendStat(stat)
+		return err
 	}
-	err = rows.Close()
-	if err != nil {
-		return res, err
+	if n == 0 {
+		return ERRNOUSER
 	}
-	return res, nil
+	return nil
 }
 
-func (d *Database) GetOpenBrands() ([]models.Brand, error) {
-	getOpen := `SELECT id FROM brands WHERE is_open=TRUE`
-	rows, err := d.db.Query(getOpen)
+// CheckPassword verifies the password and, if it is stored with an outdated algorithm or parameters, rewrites the hash
+func (d *Database) CheckPassword(c context.Context, mail, passwd string) (bool, error) {
+	stored, err := d.GetPasswordByEmail(c, mail)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	openIds, err := d.collectIds(rows)
-	if err != nil {
-		return nil, err
+	ok, rehash, err := d.hashers.Check(passwd, stored)
+	if err != nil || !ok {
+		return false, err
 	}
-	var open []models.Brand
-	for _, brand := range openIds {
-		// search for products
-		cur, err := d.GetBrandById(brand)
-		if err != nil {
-			return open, err
+	if rehash {
+		err = d.SetPassword(c, mail, passwd)
+		if err != nil { // the password is still correct, the hash will be upgraded next time
+			d.log.Errorln(err)
 		}
-		open = append(open, cur)
 	}
-	return open, nil
+	return true, nil
 }
 
-func (d *Database) CreateUser(u models.User) error {
-	insertUser := `INSERT INTO users(email, password, name, surname) VALUES ($1, $2, $3, $4)`
-	passwd, err := bcrypt.GenerateFromPassword([]byte(u.Password), BcryptCost)
+func (d *Database) SetPassword(c context.Context, mail, passwd string) error {
+	updatePassword := `UPDATE users SET password = $1 WHERE email = $2`
+	hash, err := d.hashers.Hash(passwd)
 	if err != nil {
 		return err
 	}
-	_, err = d.db.Query(insertUser, u.Email, "'"+string(passwd)+"'", u.Name, u.Surname)
+	_, err = d.db.ExecContext(c, updatePassword, hash, mail)
 	return err
 }
 
-func (d *Database) InsertOwner(o models.Owner) error {
+func (d *Database) InsertOwner(c context.Context, o models.Owner) error {
 	insertOwner := `INSERT INTO owners (name, surname, fathername, bio_info) VALUES ($1, $2, $3, $4)`
-	_, err := d.db.Query(insertOwner, o.Per.Name, o.Per.Surname, o.Per.Fathername, o.Per.BioInfo)
+	_, err := d.db.QueryContext(c, insertOwner, o.Per.Name, o.Per.Surname, o.Per.Fathername, o.Per.BioInfo)
 	return err
 }
 
-func (d *Database) GetIdByEmail(mail string) (int, error) {
+func (d *Database) GetIdByEmail(c context.Context, mail string) (int, error) {
 	getId := `SELECT id FROM users WHERE email = $1`
-	rows, err := d.db.Query(getId, mail)
+	rows, err := d.db.QueryContext(c, getId, mail)
 	if err != nil {
 		return -1, err
 	}
@@ -287,12 +150,15 @@ func (d *Database) GetIdByEmail(mail string) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	if len(ids) == 0 {
+		return -1, ERRNOUSER
+	}
 	return ids[0], nil
 }
 
-func (d *Database) GetPasswordByEmail(mail string) (string, error) {
+func (d *Database) GetPasswordByEmail(c context.Context, mail string) (string, error) {
 	getPassword := `SELECT password FROM users WHERE email = $1`
-	rows, err := d.db.Query(getPassword, mail)
+	rows, err := d.db.QueryContext(c, getPassword, mail)
 	if err != nil {
 		return "", err
 	}
@@ -307,11 +173,7 @@ func (d *Database) GetPasswordByEmail(mail string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	if passwd == "" {
-		return "", nil
-	}
-	parts := strings.Split(passwd, "'") // password is stored as 'hash', because hash can contain random symbols like / or $
-	return parts[1], nil
+	return password.TrimLegacyQuotes(passwd), nil
 }
 
 func (d *Database) collectIds(rows *sql.Rows) ([]int, error) {
@@ -328,26 +190,22 @@ func (d *Database) collectIds(rows *sql.Rows) ([]int, error) {
 	return res, nil
 }
 
-func (d *Database) generateLinkTableStatement(coreStmt, bId string, ids []int) string {
-	for _, id := range ids { // we will get insert ... values (strId, c_id_0), (strId, c_id_1), ...
-		coreStmt += " ("
-		coreStmt += bId
-		coreStmt += ", "
-		coreStmt += strconv.Itoa(id)
-		coreStmt += "),"
-	}
-	coreStmt = coreStmt[:len(coreStmt)-1]
-	return coreStmt
+// generateLinkTableStatement links every id to the brand, coreStmt is 'INSERT INTO ... VALUES'
+func (d *Database) generateLinkTableStatement(coreStmt string, bId int, ids []int) (string, []interface{}) {
+	values := models.NewBulkValues()
+	for _, id := range ids {
+		values.Add(bId, id)
+	}
+	return coreStmt + " " + values.String(), values.Args()
 }
 
 // addProducts adds products of the given brand. Operates within the transaction
-func (d *Database) addProducts(tx *sql.Tx, b *models.Brand) error {
-	addPrices := `INSERT INTO prices (low_end, high_end, currency) VALUES`
-	addPrices = b.GetBulkInsertStatementPrices(addPrices)
+func (d *Database) addProducts(ctx context.Context, tx *sql.Tx, b *models.Brand) error {
+	addPrices, args := b.GetBulkInsertStatementPrices(`INSERT INTO prices (low_end, high_end, currency) VALUES`)
 	addPrices += ` RETURNING Id`
 	// add prices
 	d.log.Debug(addPrices)
-	rows, err := tx.Query(addPrices)
+	rows, err := tx.QueryContext(ctx, addPrices, args...)
 	if err != nil {
 		return err
 	}
@@ -356,12 +214,14 @@ func (d *Database) addProducts(tx *sql.Tx, b *models.Brand) error {
 	if err != nil {
 		return err
 	}
-	addProducts := `INSERT INTO products (name, description, price_id, brand_id) VALUES`
-	addProducts = b.GetBulkInsertStatementProducts(addProducts, ids)
+	for i := range b.Products {
+		b.Products[i].Price.Id = ids[i]
+	}
+	addProducts, args := b.GetBulkInsertStatementProducts(`INSERT INTO products (name, description, price_id, brand_id) VALUES`, ids)
 	addProducts += ` RETURNING id`
 	// add product info
 	d.log.Debug(addProducts)
-	rows, err = tx.Query(addProducts)
+	rows, err = tx.QueryContext(ctx, addProducts, args...)
 	if err != nil {
 		return err
 	}
@@ -370,41 +230,51 @@ func (d *Database) addProducts(tx *sql.Tx, b *models.Brand) error {
 	if err != nil {
 		return err
 	}
+	for i := range b.Products {
+		b.Products[i].Id = ids[i]
+		err = d.addImages(ctx, tx, &b.Products[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addImages saves all images of the product as files and links them to it. Operates within the transaction
+func (d *Database) addImages(ctx context.Context, tx *sql.Tx, p *models.Product) error {
 	addImage := `INSERT INTO media (path, product_id) VALUES ($1, $2)`
-	// iterate over all products
-	for i, p := range b.Products {
-		for _, img := range p.GetImages(d.log) {
-			// first we save
-			d.log.Debug("attempting to save image")
-			path, err := d.fileWorker.SaveFile(img)
-			d.log.Debug("image saved")
-			if err != nil {
-				return err
-			}
-			// and save to db
-			d.log.Debug(addImage, ids[i])
-			_, err = tx.Exec(addImage, path, ids[i])
-			if err != nil {
-				return err
-			}
+	for _, img := range p.GetImages(d.log) {
+		if img == nil { // couldn't decode it, GetImages has already complained
+			continue
+		}
+		// first we save
+		d.log.Debug("attempting to save image")
+		path, err := d.fileWorker.SaveFile(img)
+		d.log.Debug("image saved")
+		if err != nil {
+			return err
+		}
+		// and save to db
+		d.log.Debug(addImage, p.Id)
+		_, err = tx.ExecContext(ctx, addImage, path, p.Id)
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
 // addAllInfoAfterCore this is really complex. I don't really know how to refactor it without using a lot of reflection
-// it is also basically a helper function for 2 below it; operates within a given transaction
-func (d *Database) addAllInfoAfterCore(tx *sql.Tx, b *models.Brand) error {
-	addContacts := `INSERT INTO contacts (type, contact) VALUES`
-	addContacts = b.GetBulkInsertStatementContacts(addContacts)
+// it is also basically a helper function for AddBrand and UpdateBrand; operates within a given transaction.
+// Ids of everything inserted are written back into b
+func (d *Database) addAllInfoAfterCore(ctx context.Context, tx *sql.Tx, b *models.Brand) error {
+	addContacts, contactArgs := b.GetBulkInsertStatementContacts(`INSERT INTO contacts (type, contact) VALUES`)
 	addContacts += ` RETURNING id`
-	addOwners := `INSERT INTO owners (name, surname, fathername, bio_info) VALUES`
-	addOwners = b.GetBulkInsertStatementOwners(addOwners)
-	addOwners += `RETURNING id`
-	strId := strconv.Itoa(b.Id)
+	addOwners, ownerArgs := b.GetBulkInsertStatementOwners(`INSERT INTO owners (name, surname, fathername, bio_info) VALUES`)
+	addOwners += ` RETURNING id`
 	// working with contacts here, add them, add mtm links
 	if len(b.Contacts) > 0 {
-		rows, err := tx.Query(addContacts)
+		rows, err := tx.QueryContext(ctx, addContacts, contactArgs...)
 		if err != nil {
 			return err
 		}
@@ -414,12 +284,14 @@ func (d *Database) addAllInfoAfterCore(tx *sql.Tx, b *models.Brand) error {
 		if err != nil {
 			return err
 		}
+		for i := range b.Contacts {
+			b.Contacts[i].Id = ids[i]
+		}
 		// generate link table statement
-		addLinks := `INSERT INTO l_brand_contacts (brand_id, contact_id) VALUES`
-		addLinks = d.generateLinkTableStatement(addLinks, strId, ids)
+		addLinks, args := d.generateLinkTableStatement(`INSERT INTO l_brand_contacts (brand_id, contact_id) VALUES`, b.Id, ids)
 		d.log.Debug(addLinks)
 		// adding rows
-		_, err = tx.Exec(addLinks)
+		_, err = tx.ExecContext(ctx, addLinks, args...)
 		if err != nil {
 			return err
 		}
@@ -429,7 +301,7 @@ func (d *Database) addAllInfoAfterCore(tx *sql.Tx, b *models.Brand) error {
 	// working with owners here, add them, add mtm links
 	if len(b.Owners) > 0 {
 		d.log.Debug(addOwners)
-		rows, err := tx.Query(addOwners)
+		rows, err := tx.QueryContext(ctx, addOwners, ownerArgs...)
 		if err != nil {
 			return err
 		}
@@ -438,30 +310,39 @@ func (d *Database) addAllInfoAfterCore(tx *sql.Tx, b *models.Brand) error {
 		if err != nil {
 			return err
 		}
+		for i := range b.Owners {
+			b.Owners[i].Id = ids[i]
+		}
 		// generate link table statement
-		addLinks := `INSERT INTO l_brand_owners (brand_id, owner_id) VALUES`
-		addLinks = d.generateLinkTableStatement(addLinks, strId, ids)
+		addLinks, args := d.generateLinkTableStatement(`INSERT INTO l_brand_owners (brand_id, owner_id) VALUES`, b.Id, ids)
 		// adding rows
-		_, err = tx.Exec(addLinks)
+		_, err = tx.ExecContext(ctx, addLinks, args...)
 		if err != nil {
 			return err
 		}
 	}
 	d.log.Debug("owners added")
 	// just add statistics
-	addStatistics := `INSERT INTO statistics (start_time, end_time, name, description, value, brand_id) VALUES`
-	addStatistics = b.GetBulkInsertStatementStatistics(addStatistics)
+	addStatistics, statArgs := b.GetBulkInsertStatementStatistics(`INSERT INTO statistics (start_time, end_time, name, description, value, brand_id) VALUES`)
+	addStatistics += ` RETURNING id`
 	if len(b.Statistics) > 0 {
 		d.log.Debug(addStatistics)
-		_, err := tx.Exec(addStatistics)
+		rows, err := tx.QueryContext(ctx, addStatistics, statArgs...)
+		if err != nil {
+			return err
+		}
+		ids, err := d.collectIds(rows)
 		if err != nil {
 			return err
 		}
+		for i := range b.Statistics {
+			b.Statistics[i].Id = ids[i]
+		}
 	}
 	d.log.Debug("statistics added")
 	// now add products...
 	if len(b.Products) > 0 {
-		err := d.addProducts(tx, b)
+		err := d.addProducts(ctx, tx, b)
 		if err != nil {
 			return err
 		}
@@ -474,8 +355,8 @@ func (d *Database) addAllInfoAfterCore(tx *sql.Tx, b *models.Brand) error {
 func (d *Database) AddBrand(c context.Context, b *models.Brand, addedBy string) error {
 	ctx, cancel := context.WithCancel(c)
 	defer cancel()
-	addCore := `INSERT INTO brands (name, description, city, is_open, added_by) VALUES ($1, $2, $3, $4, $5) RETURNING id`
-	uid, err := d.GetIdByEmail(addedBy)
+	addCore := `INSERT INTO brands (name, description, city, status, added_by) VALUES ($1, $2, $3, $4, $5) RETURNING id, version`
+	uid, err := d.GetIdByEmail(c, addedBy)
 	// transaction starts here
 	tx, err := d.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -483,7 +364,7 @@ func (d *Database) AddBrand(c context.Context, b *models.Brand, addedBy string)
 	}
 	// add core brand info
 	id := 0
-	err = tx.QueryRow(addCore, b.Name, b.Description, b.Location, b.IsOpen, uid).Scan(&id) // pq disables LastInsertId feature, unfortunately
+	err = tx.QueryRowContext(ctx, addCore, b.Name, b.Description, b.Location, b.Status, uid).Scan(&id, &b.Version) // pq disables LastInsertId feature, unfortunately
 	if err != nil {
 		return err
 	}
@@ -492,68 +373,31 @@ func (d *Database) AddBrand(c context.Context, b *models.Brand, addedBy string)
 	}
 	b.Id = id
 	d.log.Debug("brand added")
-	err = d.addAllInfoAfterCore(tx, b)
-	if err != nil {
-		return err
-	}
-	err = tx.Commit()
-	return err
-}
-
-// UpdateBrand by update I mean basically delete all old data and insert new. Only the core info is really updated, to preserve the id number
-func (d *Database) UpdateBrand(c context.Context, b *models.Brand, updatedBy string) error {
-	ctx, cancel := context.WithCancel(c)
-	defer cancel()
-	// let's check who's trying to update
-	uid, err := d.GetIdByEmail(updatedBy)
+	err = d.addAllInfoAfterCore(ctx, tx, b)
 	if err != nil {
 		return err
 	}
-	var added int
-	getBrandCreator := `SELECT added_by FROM brands WHERE id = $1`
-	err = d.db.QueryRow(getBrandCreator, b.Id).Scan(&added)
+	err = d.updateSearchVector(ctx, tx, b.Id)
 	if err != nil {
 		return err
 	}
-	// user doesn't have permission to do this
-	if uid != added {
-		return ERRNOPERM
-	}
-	updateCoreInfo := `UPDATE brands SET name = $1, description = $2, city = $3, is_open = $4 WHERE id = $5`
-	deleteOldOwners := `DELETE FROM owners WHERE id IN (SELECT owner_id FROM l_brand_owners WHERE brand_id = $1)`
-	deleteOldPrices := `DELETE FROM prices WHERE id IN (SELECT price_id FROM products WHERE brand_id = $1)`
-	deleteOldProducts := `DELETE FROM products WHERE brand_id = $1`
-	deleteOldStats := `DELETE FROM statistics WHERE brand_id = $1`
-	deleteOldContacts := `DELETE FROM contacts WHERE id IN (SELECT contact_id FROM l_brand_contacts WHERE brand_id = $1)`
-	// transaction begins here
-	tx, err := d.db.BeginTx(ctx, nil)
-	_, err = tx.Exec(updateCoreInfo, b.Name, b.Description, b.Location, b.IsOpen, b.Id)
+	err = d.addRevision(ctx, tx, b, uid)
 	if err != nil {
 		return err
 	}
-	delList := []string{deleteOldOwners, deleteOldContacts, deleteOldPrices, deleteOldProducts, deleteOldStats}
-	for _, st := range delList {
-		_, err = tx.Exec(st, b.Id)
-		if err != nil {
-			return err
-		}
-	}
-	err = d.addAllInfoAfterCore(tx, b)
-	if err != nil {
-		return err
-	}
-	// transaction committed, done
 	err = tx.Commit()
 	return err
 }
 
-func (d *Database) GetBrandsAddedByUser(email string) ([]models.Brand, error) {
-	uid, err := d.GetIdByEmail(email)
+func (d *Database) GetBrandsAddedByUser(c context.Context, email string) ([]models.Brand, error) {
+	uid, err := d.GetIdByEmail(c, email)
 	if err != nil {
 		return nil, err
 	}
-	getBIds := `SELECT id FROM brands WHERE added_by = $1`
-	rows, err := d.db.Query(getBIds, uid)
+	// brands the user added and the ones they were invited to edit
+	getBIds := `SELECT id FROM brands WHERE added_by = $1 AND deleted_at IS NULL
+		UNION SELECT e.brand_id FROM brand_editors e JOIN brands b ON b.id = e.brand_id WHERE e.user_id = $1 AND e.accepted AND b.deleted_at IS NULL ORDER BY 1`
+	rows, err := d.db.QueryContext(c, getBIds, uid)
 	if err != nil {
 		return nil, err
 	}
@@ -561,13 +405,17 @@ func (d *Database) GetBrandsAddedByUser(email string) ([]models.Brand, error) {
 	if err != nil {
 		return nil, err
 	}
-	var res []models.Brand
-	for _, id := range ids {
-		brand, err := d.GetBrandById(id)
-		if err != nil {
-			return nil, err
-		}
-		res = append(res, brand)
+	if len(ids) == 0 {
+		return nil, nil
 	}
-	return res, nil
+	return d.GetBrandsByIds(c, ids, true)
+}
+
+// GetBrandVersion is a cheap way to tell whether the brand changed without loading it. The status comes along,
+// since it decides who may see the brand at all
+func (d *Database) GetBrandVersion(c context.Context, id int) (int, models.BrandStatus, error) {
+	var version int
+	var status models.BrandStatus
+	err := d.db.QueryRowContext(c, `SELECT version, status FROM brands WHERE id = $1 AND deleted_at IS NULL`, id).Scan(&version, &status)
+	return version, status, err
 }
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DeleteBrand only marks the brand, it disappears from everywhere but can be restored until it's purged
+func (d *Database) DeleteBrand(c context.Context, brandId int, deletedBy string) error {
+	deleteBrand := `UPDATE brands SET deleted_at = now(), version = version + 1 WHERE id = $1 AND deleted_at IS NULL`
+	return d.changeBrand(c, brandId, deletedBy, deleteBrand, brandId)
+}
+
+// RestoreBrand gives sql.ErrNoRows if the brand isn't deleted, or is already purged
+func (d *Database) RestoreBrand(c context.Context, brandId int, restoredBy string) error {
+	restoreBrand := `UPDATE brands SET deleted_at = NULL, version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL`
+	return d.changeBrand(c, brandId, restoredBy, restoreBrand, brandId)
+}
+
+// PurgeDeletedBrands removes brands deleted before the given time for good, with everything they had, image files too.
+// Statistics, products, media and history go with the brand by cascade; prices, owners and contacts are only linked, so they go by hand
+func (d *Database) PurgeDeletedBrands(c context.Context, before time.Time) (int, error) {
+	ctx, cancel := context.WithCancel(c)
+	defer cancel()
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM brands WHERE deleted_at < $1 FOR UPDATE`, before)
+	if err != nil {
+		return 0, err
+	}
+	ids, err := d.collectIds(rows)
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, tx.Commit()
+	}
+	rows, err = tx.QueryContext(ctx, `SELECT m.path FROM media m JOIN products p ON p.id = m.product_id WHERE p.brand_id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+	orphans, err := collectStrings(rows)
+	if err != nil {
+		return 0, err
+	}
+	purge := []string{
+		`DELETE FROM prices WHERE id IN (SELECT price_id FROM products WHERE brand_id = ANY($1))`,
+		`DELETE FROM contacts WHERE id IN (SELECT contact_id FROM l_brand_contacts WHERE brand_id = ANY($1))`,
+		`DELETE FROM owners WHERE id IN (SELECT owner_id FROM l_brand_owners WHERE brand_id = ANY($1))`,
+		`DELETE FROM brands WHERE id = ANY($1)`,
+	}
+	for _, st := range purge {
+		_, err = tx.ExecContext(ctx, st, pq.Array(ids))
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	for _, path := range orphans {
+		err = d.fileWorker.DeleteFile(path)
+		if err != nil {
+			d.log.Errorln(err)
+		}
+	}
+	return len(ids), nil
+}
+
+// RunPurge purges brands deleted longer than retention ago every so often, until ctx is done
+func (d *Database) RunPurge(ctx context.Context, every, retention time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := d.PurgeDeletedBrands(ctx, time.Now().Add(-retention))
+			if err != nil {
+				d.log.Errorln(err)
+				continue
+			}
+			if n > 0 {
+				d.log.Infof("purged %d deleted brands", n)
+			}
+		}
+	}
+}
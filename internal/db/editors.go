@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"accelerator/models"
+)
+
+var ERRNOTEDITOR = errors.New("this user is not an editor of the brand")
+
+// InviteEditor inviting someone twice does nothing, the invite has to be accepted before it gives any access
+func (d *Database) InviteEditor(c context.Context, brandId int, email string, invitedBy int) error {
+	uid, err := d.GetIdByEmail(c, email)
+	if err != nil {
+		return err
+	}
+	invite := `INSERT INTO brand_editors (brand_id, user_id, invited_by) VALUES ($1, $2, $3) ON CONFLICT (brand_id, user_id) DO NOTHING`
+	_, err = d.db.ExecContext(c, invite, brandId, uid, invitedBy)
+	return err
+}
+
+func (d *Database) AcceptInvite(c context.Context, brandId, uid int) error {
+	accept := `UPDATE brand_editors SET accepted = TRUE WHERE brand_id = $1 AND user_id = $2`
+	res, err := d.db.ExecContext(c, accept, brandId, uid)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ERRNOTEDITOR
+	}
+	return nil
+}
+
+// RemoveEditor works both for accepted editors and pending invites
+func (d *Database) RemoveEditor(c context.Context, brandId, uid int) error {
+	remove := `DELETE FROM brand_editors WHERE brand_id = $1 AND user_id = $2`
+	_, err := d.db.ExecContext(c, remove, brandId, uid)
+	return err
+}
+
+func (d *Database) IsBrandEditor(c context.Context, brandId, uid int) (bool, error) {
+	var accepted bool
+	getEditor := `SELECT accepted FROM brand_editors WHERE brand_id = $1 AND user_id = $2`
+	err := d.db.QueryRowContext(c, getEditor, brandId, uid).Scan(&accepted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return accepted, err
+}
+
+func (d *Database) GetBrandEditors(c context.Context, brandId int) ([]models.Editor, error) {
+	getEditors := `SELECT u.email, u.name, u.surname, e.accepted FROM brand_editors e JOIN users u ON u.id = e.user_id WHERE e.brand_id = $1 ORDER BY e.id`
+	rows, err := d.db.QueryContext(c, getEditors, brandId)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	res := []models.Editor{}
+	for rows.Next() {
+		var e models.Editor
+		err = rows.Scan(&e.Email, &e.Name, &e.Surname, &e.Accepted)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
+
+// GetPendingInvites ids of the brands the user was invited to, but hasn't accepted yet
+func (d *Database) GetPendingInvites(c context.Context, uid int) ([]int, error) {
+	getInvites := `SELECT brand_id FROM brand_editors WHERE user_id = $1 AND NOT accepted ORDER BY id`
+	rows, err := d.db.QueryContext(c, getInvites, uid)
+	if err != nil {
+		return nil, err
+	}
+	return d.collectIds(rows)
+}
+
+// TransferBrand makes an accepted editor the primary owner; the previous owner stays on as an editor
+func (d *Database) TransferBrand(c context.Context, brandId, from, to int) error {
+	ctx, cancel := context.WithCancel(c)
+	defer cancel()
+	isEditor, err := d.IsBrandEditor(c, brandId, to)
+	if err != nil {
+		return err
+	}
+	if !isEditor {
+		return ERRNOTEDITOR
+	}
+	setOwner := `UPDATE brands SET added_by = $1 WHERE id = $2`
+	dropEditor := `DELETE FROM brand_editors WHERE brand_id = $1 AND user_id = $2`
+	addEditor := `INSERT INTO brand_editors (brand_id, user_id, invited_by, accepted) VALUES ($1, $2, $3, TRUE) ON CONFLICT (brand_id, user_id) DO UPDATE SET accepted = TRUE`
+	// transaction begins here
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, setOwner, to, brandId)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, dropEditor, brandId, to)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, addEditor, brandId, from, to)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
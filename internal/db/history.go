@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"accelerator/models"
+)
+
+// addRevision saves b as it is now, without images: they are heavy and don't change much. Operates within the transaction
+func (d *Database) addRevision(ctx context.Context, tx *sql.Tx, b *models.Brand, uid int) error {
+	snap := *b
+	snap.Products = make([]models.Product, len(b.Products))
+	for i, p := range b.Products {
+		p.Media = nil
+		snap.Products[i] = p
+	}
+	raw, err := json.Marshal(&snap)
+	if err != nil {
+		return err
+	}
+	addRevision := `INSERT INTO History(brand_id, version, edited_by, snapshot) VALUES ($1, $2, $3, $4)`
+	_, err = tx.ExecContext(ctx, addRevision, b.Id, b.Version, uid, raw)
+	return err
+}
+
+// copyRevision saves the latest snapshot of the brand again under the version it has now, with its current status.
+// It is for changes that bump the version without touching what snapshots have: status, deletion and restoring. Operates within the transaction
+func (d *Database) copyRevision(ctx context.Context, tx *sql.Tx, brandId, uid int) error {
+	copyRevision := `INSERT INTO History(brand_id, version, edited_by, snapshot)
+		SELECT b.id, b.version, $2, h.snapshot || jsonb_build_object('status', b.status, 'status_reason', coalesce(b.status_reason, ''))
+		FROM brands b, LATERAL (SELECT snapshot FROM History WHERE brand_id = b.id ORDER BY version DESC LIMIT 1) h WHERE b.id = $1`
+	_, err := tx.ExecContext(ctx, copyRevision, brandId, uid)
+	return err
+}
+
+// changeBrand runs query, which changes only the brand brandId, and saves a revision of it by changedBy in the same transaction.
+// Gives sql.ErrNoRows if the query didn't change anything
+func (d *Database) changeBrand(c context.Context, brandId int, changedBy string, query string, args ...interface{}) error {
+	ctx, cancel := context.WithCancel(c)
+	defer cancel()
+	uid, err := d.GetIdByEmail(c, changedBy)
+	if err != nil {
+		return err
+	}
+	// transaction begins here
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	err = d.copyRevision(ctx, tx, brandId, uid)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetRevisions newest first, without snapshots
+func (d *Database) GetRevisions(c context.Context, brandId int) ([]models.History, error) {
+	getRevisions := `SELECT h.id, h.version, COALESCE(u.email, ''), h.created_at FROM History h LEFT JOIN users u ON u.id = h.edited_by
+		WHERE h.brand_id = $1 ORDER BY h.version DESC`
+	rows, err := d.db.QueryContext(c, getRevisions, brandId)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	res := []models.History{}
+	for rows.Next() {
+		h := models.History{BrandId: brandId}
+		err = rows.Scan(&h.Id, &h.Version, &h.EditedBy, &h.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, h)
+	}
+	return res, rows.Err()
+}
+
+// GetRevision gives sql.ErrNoRows if the brand never had this version saved
+func (d *Database) GetRevision(c context.Context, brandId, version int) (models.History, error) {
+	getRevision := `SELECT h.id, COALESCE(u.email, ''), h.created_at, h.snapshot FROM History h LEFT JOIN users u ON u.id = h.edited_by
+		WHERE h.brand_id = $1 AND h.version = $2`
+	h := models.History{BrandId: brandId, Version: version}
+	var raw []byte
+	err := d.db.QueryRowContext(c, getRevision, brandId, version).Scan(&h.Id, &h.EditedBy, &h.CreatedAt, &raw)
+	if err != nil {
+		return h, err
+	}
+	h.Brand = &models.Brand{}
+	err = json.Unmarshal(raw, h.Brand)
+	if err != nil {
+		return h, err
+	}
+	h.Brand.Version = version
+	return h, nil
+}
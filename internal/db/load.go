@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+
+	fileWorker "accelerator/internal/mediaworker"
+	"accelerator/models"
+	"github.com/lib/pq"
+)
+
+// GetBrandsByIds loads whole brands in the order of ids, ids of missing or deleted brands are skipped.
+// It takes the same number of queries for one brand as for a page of them: every kind of child comes in one query for all brands.
+// Without media images aren't read from disk, products just come without them
+func (d *Database) GetBrandsByIds(c context.Context, ids []int, withMedia bool) ([]models.Brand, error) {
+	getCore := `SELECT id, name, description, city, status, status_reason, version FROM brands WHERE id = ANY($1) AND deleted_at IS NULL`
+	getProducts := `SELECT p.brand_id, p.id, p.name, p.description, COALESCE(p.price_id, 0), COALESCE(pr.low_end, 0), COALESCE(pr.high_end, 0), COALESCE(pr.currency, '')
+		FROM products p LEFT JOIN prices pr ON pr.id = p.price_id WHERE p.brand_id = ANY($1) ORDER BY p.id`
+	getMedia := `SELECT m.product_id, m.path FROM media m JOIN products p ON p.id = m.product_id WHERE p.brand_id = ANY($1) ORDER BY m.id`
+	getOwners := `SELECT l.brand_id, o.id, o.name, o.surname, o.fathername, o.bio_info FROM l_brand_owners l JOIN owners o ON o.id = l.owner_id
+		WHERE l.brand_id = ANY($1) ORDER BY l.id` // email is not meant to be publicly visible
+	getContacts := `SELECT l.brand_id, c.id, c.type, c.contact FROM l_brand_contacts l JOIN contacts c ON c.id = l.contact_id
+		WHERE l.brand_id = ANY($1) ORDER BY l.id`
+	getStats := `SELECT brand_id, id, name, description, start_time, end_time, value FROM statistics WHERE brand_id = ANY($1) ORDER BY id`
+	queries := 0
+	brands := make(map[int]*models.Brand, len(ids))
+	// core info first, the rest is only looked up for brands that are there
+	rows, err := d.db.QueryContext(c, getCore, pq.Array(ids))
+	queries++
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var b models.Brand
+		err = rows.Scan(&b.Id, &b.Name, &b.Description, &b.Location, &b.Status, &b.Reason, &b.Version)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		brands[b.Id] = &b
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	found := make([]int, 0, len(brands))
+	for id := range brands {
+		found = append(found, id)
+	}
+	if len(found) > 0 {
+		// products are collected first and appended at the end, so that media can still be added to them
+		products := make(map[int]*models.Product)
+		var productOrder []int
+		productBrand := make(map[int]int)
+		rows, err = d.db.QueryContext(c, getProducts, pq.Array(found))
+		queries++
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var brandId int
+			p := models.Product{}
+			err = rows.Scan(&brandId, &p.Id, &p.Name, &p.Description, &p.Price.Id, &p.Price.LowEnd, &p.Price.HighEnd, &p.Price.Currency)
+			if err != nil {
+				_ = rows.Close()
+				return nil, err
+			}
+			products[p.Id] = &p
+			productOrder = append(productOrder, p.Id)
+			productBrand[p.Id] = brandId
+		}
+		err = rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		if withMedia && len(products) > 0 {
+			rows, err = d.db.QueryContext(c, getMedia, pq.Array(found))
+			queries++
+			if err != nil {
+				return nil, err
+			}
+			for rows.Next() {
+				var productId int
+				var path string
+				err = rows.Scan(&productId, &path)
+				if err != nil {
+					_ = rows.Close()
+					return nil, err
+				}
+				// fetch file from disk
+				file, err := d.fileWorker.LoadFile(path)
+				if err != nil {
+					_ = rows.Close()
+					return nil, err
+				}
+				p := products[productId]
+				p.Media = append(p.Media, "data:image/jpeg;base64,"+fileWorker.ImageToString(file))
+			}
+			err = rows.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, id := range productOrder {
+			brands[productBrand[id]].AppendProduct(*products[id])
+		}
+		rows, err = d.db.QueryContext(c, getOwners, pq.Array(found))
+		queries++
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var brandId, id int
+			cur := models.Person{}
+			err = rows.Scan(&brandId, &id, &cur.Name, &cur.Surname, &cur.Fathername, &cur.BioInfo)
+			if err != nil {
+				_ = rows.Close()
+				return nil, err
+			}
+			o := models.NewOwner(&cur)
+			o.Id = id
+			brands[brandId].AppendOwner(o)
+		}
+		err = rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		rows, err = d.db.QueryContext(c, getContacts, pq.Array(found))
+		queries++
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var brandId, id int
+			var curtype, curlink string
+			err = rows.Scan(&brandId, &id, &curtype, &curlink)
+			if err != nil {
+				_ = rows.Close()
+				return nil, err
+			}
+			c := models.NewContact(curtype, curlink)
+			c.Id = id
+			brands[brandId].AppendContact(c)
+		}
+		err = rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		rows, err = d.db.QueryContext(c, getStats, pq.Array(found))
+		queries++
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var brandId int
+			stat := models.StatisticMeasure{}
+			err = rows.Scan(&brandId, &stat.Id, &stat.Name, &stat.Description, &stat.StartPeriod, &stat.EndPeriod, &stat.Value)
+			if err != nil {
+				_ = rows.Close()
+				return nil, err
+			}
+			brands[brandId].AppendStat(stat)
+		}
+		err = rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	d.log.Debugf("loaded %d brands in %d queries", len(brands), queries)
+	res := make([]models.Brand, 0, len(brands))
+	for _, id := range ids {
+		if b, ok := brands[id]; ok {
+			res = append(res, *b)
+			delete(brands, id) // an id asked for twice still gives the brand once
+		}
+	}
+	return res, nil
+}
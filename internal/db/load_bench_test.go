@@ -0,0 +1,232 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"accelerator/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// fakeBrands is a database/sql driver that knows just enough of the brand loading queries to answer them, and counts them.
+// Every brand it has gets one product, owner, contact and statistic, so that each kind of child really is loaded
+type fakeBrands struct {
+	brands  int // ids are 1..brands
+	queries atomic.Int64
+}
+
+func (f *fakeBrands) Open(string) (driver.Conn, error) {
+	return &fakeConn{f}, nil
+}
+
+type fakeConn struct {
+	f *fakeBrands
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{f: c.f, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fake brands are read only")
+}
+
+type fakeStmt struct {
+	f     *fakeBrands
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("fake brands are read only")
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.f.queries.Add(1)
+	all := make([]int64, s.f.brands)
+	for i := range all {
+		all[i] = int64(i + 1)
+	}
+	var cols []string
+	var rows [][]driver.Value
+	q := s.query
+	switch {
+	case strings.Contains(q, "FROM users WHERE email"):
+		cols, rows = []string{"id"}, [][]driver.Value{{int64(1)}}
+	case strings.Contains(q, "UNION SELECT e.brand_id"):
+		cols = []string{"id"}
+		for _, id := range all {
+			rows = append(rows, []driver.Value{id})
+		}
+	case strings.HasPrefix(q, "SELECT b.id, ("):
+		cols = []string{"id", "key"}
+		for _, id := range all {
+			rows = append(rows, []driver.Value{id, strconv.FormatInt(id, 10)})
+		}
+	case strings.HasPrefix(q, "SELECT id, name, description, city, status"):
+		cols = []string{"id", "name", "description", "city", "status", "status_reason", "version"}
+		for _, id := range askedIds(args) {
+			rows = append(rows, []driver.Value{id, "brand " + strconv.FormatInt(id, 10), "", "Moscow", "published", "", int64(1)})
+		}
+	case strings.Contains(q, "FROM products p LEFT JOIN prices"):
+		cols = []string{"brand_id", "id", "name", "description", "price_id", "low_end", "high_end", "currency"}
+		for _, id := range askedIds(args) {
+			rows = append(rows, []driver.Value{id, id, "product", "", id, int64(1), int64(2), "RUB"})
+		}
+	case strings.Contains(q, "FROM media"):
+		cols = []string{"product_id", "path"} // no images, they would be read from disk
+	case strings.Contains(q, "FROM l_brand_owners"):
+		cols = []string{"brand_id", "id", "name", "surname", "fathername", "bio_info"}
+		for _, id := range askedIds(args) {
+			rows = append(rows, []driver.Value{id, id, "Ivan", "Ivanov", "", ""})
+		}
+	case strings.Contains(q, "FROM l_brand_contacts"):
+		cols = []string{"brand_id", "id", "type", "contact"}
+		for _, id := range askedIds(args) {
+			rows = append(rows, []driver.Value{id, id, "phone", "+7000"})
+		}
+	case strings.Contains(q, "FROM statistics"):
+		cols = []string{"brand_id", "id", "name", "description", "start_time", "end_time", "value"}
+		for _, id := range askedIds(args) {
+			rows = append(rows, []driver.Value{id, id, "sales", "", time.Unix(0, 0), time.Unix(3600, 0), float64(1)})
+		}
+	default:
+		return nil, errors.New("fake brands don't know this query: " + q)
+	}
+	return &fakeRows{cols: cols, rows: rows}, nil
+}
+
+// askedIds reads the ANY($1) argument, pq sends arrays as {1,2,3}
+func askedIds(args []driver.Value) []int64 {
+	s, _ := args[0].(string)
+	var ids []int64
+	for _, part := range strings.Split(strings.Trim(s, "{}"), ",") {
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.cols
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+var fakeDrivers atomic.Int64
+
+// newFakeDatabase a Database over fakeBrands with the given number of brands
+func newFakeDatabase(tb testing.TB, brands int) (*Database, *fakeBrands) {
+	tb.Helper()
+	f := &fakeBrands{brands: brands}
+	name := "fakebrands" + strconv.FormatInt(fakeDrivers.Add(1), 10) // sql.Register doesn't take the same name twice
+	sql.Register(name, f)
+	conn, err := sql.Open(name, "")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = conn.Close() })
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+	return &Database{db: conn, log: logger}, f
+}
+
+// pageSize what the server asks GetOpenBrands for by default
+const pageSize = 30
+
+type brandLoad struct {
+	name string
+	load func(d *Database) (int, error) // gives how many brands came back
+}
+
+var brandLoads = []brandLoad{
+	{"GetBrandById", func(d *Database) (int, error) {
+		_, err := d.GetBrandById(context.Background(), 1)
+		return 1, err
+	}},
+	{"GetOpenBrands", func(d *Database) (int, error) {
+		res, _, err := d.GetOpenBrands(context.Background(), &models.BrandFilter{}, models.BrandCursor{}, pageSize)
+		return len(res), err
+	}},
+	{"GetBrandsAddedByUser", func(d *Database) (int, error) {
+		res, err := d.GetBrandsAddedByUser(context.Background(), "owner@example.com")
+		return len(res), err
+	}},
+}
+
+// TestBrandLoadQueryCount loading a whole page of brands takes as many queries as loading one
+func TestBrandLoadQueryCount(t *testing.T) {
+	for _, l := range brandLoads {
+		counts := make(map[int]int64)
+		for _, brands := range []int{1, pageSize} {
+			d, f := newFakeDatabase(t, brands)
+			n, err := l.load(d)
+			if err != nil {
+				t.Fatalf("%s with %d brands: %v", l.name, brands, err)
+			}
+			if l.name != "GetBrandById" && n != brands {
+				t.Fatalf("%s with %d brands gave %d", l.name, brands, n)
+			}
+			counts[brands] = f.queries.Load()
+		}
+		if counts[1] != counts[pageSize] {
+			t.Errorf("%s: %d queries for 1 brand, %d for %d", l.name, counts[1], counts[pageSize], pageSize)
+		}
+	}
+}
+
+// BenchmarkBrandLoad reports queries per call next to the time, for one brand and for a full page
+func BenchmarkBrandLoad(b *testing.B) {
+	for _, l := range brandLoads {
+		for _, brands := range []int{1, pageSize} {
+			b.Run(l.name+"/"+strconv.Itoa(brands), func(b *testing.B) {
+				d, f := newFakeDatabase(b, brands)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					_, err := l.load(d)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(f.queries.Load())/float64(b.N), "queries/op")
+			})
+		}
+	}
+}
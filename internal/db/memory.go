@@ -0,0 +1,934 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"html"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"accelerator/internal/password"
+	"accelerator/models"
+)
+
+var ERRNAMETAKEN = errors.New("there is a brand with this name already")
+var ERREMAILTAKEN = errors.New("there is a user with this email already")
+
+type memUser struct {
+	id       int
+	user     models.User // Password is the hash
+	role     models.Role
+	verified bool
+}
+
+type memBrand struct {
+	brand     models.Brand // images are kept as the data urls they came in
+	addedBy   int          // -1 if nobody
+	createdAt time.Time
+	deletedAt *time.Time
+}
+
+type memEditor struct {
+	brandId, userId, invitedBy int
+	accepted                   bool
+}
+
+// MemoryRepository keeps users and brands in process memory, for tests and demos where postgres is too much.
+// It behaves like Database as far as the server can tell, only search and suggestions are plain substring matches
+type MemoryRepository struct {
+	mu      sync.RWMutex
+	hashers *password.Hashers
+	users   map[string]*memUser
+	brands  map[int]*memBrand
+	editors []memEditor
+	history map[int][]models.History
+	lastId  int // one sequence for every id, they only have to be unique
+}
+
+func NewMemoryRepository(hashers *password.Hashers) *MemoryRepository {
+	return &MemoryRepository{hashers: hashers, users: make(map[string]*memUser), brands: make(map[int]*memBrand), history: make(map[int][]models.History)}
+}
+
+func (m *MemoryRepository) nextId() int {
+	m.lastId++
+	return m.lastId
+}
+
+// cloneBrand copies everything, so that nothing stored can be changed from outside. Without media products come without images
+func cloneBrand(b *models.Brand, withMedia bool) models.Brand {
+	res := *b
+	res.Owners = append([]models.Owner(nil), b.Owners...)
+	for i := range res.Owners {
+		res.Owners[i].Hist = []models.History{}
+	}
+	res.Contacts = append([]models.Contact(nil), b.Contacts...)
+	res.Statistics = append([]models.StatisticMeasure(nil), b.Statistics...)
+	res.Products = append([]models.Product(nil), b.Products...)
+	for i := range res.Products {
+		if withMedia {
+			res.Products[i].Media = append([]string(nil), b.Products[i].Media...)
+		} else {
+			res.Products[i].Media = nil
+		}
+	}
+	return res
+}
+
+func (m *MemoryRepository) userById(id int) *memUser {
+	for _, u := range m.users {
+		if u.id == id {
+			return u
+		}
+	}
+	return nil
+}
+
+// liveBrand a brand that exists and isn't deleted
+func (m *MemoryRepository) liveBrand(id int) (*memBrand, bool) {
+	b, ok := m.brands[id]
+	if !ok || b.deletedAt != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+func (m *MemoryRepository) nameTaken(name string, except int) bool {
+	for id, b := range m.brands {
+		if id != except && b.brand.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryRepository) CreateUser(_ context.Context, u models.User) error {
+	hash, err := m.hashers.Hash(u.Password)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[u.Email]; ok {
+		return ERREMAILTAKEN
+	}
+	u.Password = hash
+	m.users[u.Email] = &memUser{id: m.nextId(), user: u, role: models.USER}
+	return nil
+}
+
+func (m *MemoryRepository) IsVerified(_ context.Context, mail string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.users[mail]
+	if !ok {
+		return false, ERRNOUSER
+	}
+	return u.verified, nil
+}
+
+func (m *MemoryRepository) SetVerified(_ context.Context, mail string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[mail]
+	if !ok {
+		return ERRNOUSER
+	}
+	u.verified = true
+	return nil
+}
+
+func (m *MemoryRepository) CheckPassword(c context.Context, mail, passwd string) (bool, error) {
+	stored, err := m.GetPasswordByEmail(c, mail)
+	if err != nil {
+		return false, err
+	}
+	ok, rehash, err := m.hashers.Check(passwd, stored)
+	if err != nil || !ok {
+		return false, err
+	}
+	if rehash {
+		_ = m.SetPassword(c, mail, passwd) // it can't fail here, the user is there
+	}
+	return true, nil
+}
+
+func (m *MemoryRepository) SetPassword(_ context.Context, mail, passwd string) error {
+	hash, err := m.hashers.Hash(passwd)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if u, ok := m.users[mail]; ok {
+		u.user.Password = hash
+	}
+	return nil
+}
+
+func (m *MemoryRepository) GetIdByEmail(_ context.Context, mail string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.users[mail]
+	if !ok {
+		return -1, ERRNOUSER
+	}
+	return u.id, nil
+}
+
+func (m *MemoryRepository) GetPasswordByEmail(_ context.Context, mail string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.users[mail]
+	if !ok {
+		return "", nil
+	}
+	return u.user.Password, nil
+}
+
+func (m *MemoryRepository) GetRoleByEmail(_ context.Context, mail string) (models.Role, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.users[mail]
+	if !ok {
+		return models.USER, ERRNOUSER
+	}
+	return u.role, nil
+}
+
+func (m *MemoryRepository) SetRole(_ context.Context, mail string, role models.Role) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[mail]
+	if !ok {
+		return ERRNOUSER
+	}
+	u.role = role
+	return nil
+}
+
+// assignIds gives new ids to children that don't have a known one, the same way UpdateBrand inserts them.
+// stored is nil for new brands
+func (m *MemoryRepository) assignIds(b *models.Brand, stored *models.Brand) {
+	known := make(map[int]bool)
+	prices := make(map[int]int)
+	media := make(map[int][]string)
+	if stored != nil {
+		for _, c := range stored.Contacts {
+			known[c.Id] = true
+		}
+		for _, o := range stored.Owners {
+			known[o.Id] = true
+		}
+		for _, s := range stored.Statistics {
+			known[s.Id] = true
+		}
+		for _, p := range stored.Products {
+			known[p.Id] = true
+			prices[p.Id] = p.Price.Id
+			media[p.Id] = p.Media
+		}
+	}
+	// every id is taken once, a second child with the same id is new
+	keep := func(id int) bool {
+		if known[id] {
+			delete(known, id)
+			return true
+		}
+		return false
+	}
+	for i := range b.Contacts {
+		if !keep(b.Contacts[i].Id) {
+			b.Contacts[i].Id = m.nextId()
+		}
+	}
+	for i := range b.Owners {
+		if !keep(b.Owners[i].Id) {
+			b.Owners[i].Id = m.nextId()
+		}
+	}
+	for i := range b.Statistics {
+		if !keep(b.Statistics[i].Id) {
+			b.Statistics[i].Id = m.nextId()
+		}
+	}
+	for i := range b.Products {
+		p := &b.Products[i]
+		if keep(p.Id) {
+			p.Price.Id = prices[p.Id]
+			if p.Media == nil {
+				p.Media = media[p.Id]
+			}
+			continue
+		}
+		p.Id, p.Price.Id = m.nextId(), m.nextId()
+	}
+}
+
+func (m *MemoryRepository) addRevision(b *models.Brand, uid int) {
+	snap := cloneBrand(b, false)
+	editedBy := ""
+	if u := m.userById(uid); u != nil {
+		editedBy = u.user.Email
+	}
+	m.history[b.Id] = append(m.history[b.Id], models.History{Id: m.nextId(), BrandId: b.Id, Version: b.Version, EditedBy: editedBy, CreatedAt: time.Now(), Brand: &snap})
+}
+
+func (m *MemoryRepository) AddBrand(_ context.Context, b *models.Brand, addedBy string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.nameTaken(b.Name, 0) {
+		return ERRNAMETAKEN
+	}
+	uid := -1
+	if u, ok := m.users[addedBy]; ok {
+		uid = u.id
+	}
+	b.Id, b.Version = m.nextId(), 1
+	if b.Status == "" {
+		b.Status = models.DRAFT
+	}
+	m.assignIds(b, nil)
+	m.brands[b.Id] = &memBrand{brand: cloneBrand(b, true), addedBy: uid, createdAt: time.Now()}
+	m.addRevision(b, uid)
+	return nil
+}
+
+func (m *MemoryRepository) UpdateBrand(_ context.Context, b *models.Brand, editedBy string, keepStatus bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[editedBy]
+	if !ok {
+		return ERRNOUSER
+	}
+	stored, ok := m.liveBrand(b.Id)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if b.Version != 0 && b.Version != stored.brand.Version {
+		return ERRSTALE
+	}
+	if m.nameTaken(b.Name, b.Id) {
+		return ERRNAMETAKEN
+	}
+	m.assignIds(b, &stored.brand)
+	b.Version = stored.brand.Version + 1
+	b.Status, b.Reason = stored.brand.Status, stored.brand.Reason
+	if !keepStatus && (b.Status == models.PUBLISHED || b.Status == models.REJECTED) {
+		b.Status = models.PENDING
+	}
+	stored.brand = cloneBrand(b, true)
+	m.addRevision(b, u.id)
+	return nil
+}
+
+func (m *MemoryRepository) GetBrandById(_ context.Context, id int) (models.Brand, error) {
+	return m.getBrand(id, true)
+}
+
+func (m *MemoryRepository) GetBrandForEdit(_ context.Context, id int) (models.Brand, error) {
+	return m.getBrand(id, false)
+}
+
+func (m *MemoryRepository) getBrand(id int, withMedia bool) (models.Brand, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.liveBrand(id)
+	if !ok {
+		return models.Brand{}, sql.ErrNoRows
+	}
+	return cloneBrand(&b.brand, withMedia), nil
+}
+
+func (m *MemoryRepository) GetBrandsByIds(_ context.Context, ids []int, withMedia bool) ([]models.Brand, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := make([]models.Brand, 0, len(ids))
+	seen := make(map[int]bool)
+	for _, id := range ids {
+		if b, ok := m.liveBrand(id); ok && !seen[id] {
+			res = append(res, cloneBrand(&b.brand, withMedia))
+			seen[id] = true
+		}
+	}
+	return res, nil
+}
+
+func (m *MemoryRepository) GetBrandIdByName(_ context.Context, name string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for id, b := range m.brands {
+		if b.deletedAt == nil && b.brand.Name == name {
+			return id, nil
+		}
+	}
+	return -1, nil
+}
+
+func (m *MemoryRepository) GetBrandVersion(_ context.Context, id int) (int, models.BrandStatus, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.liveBrand(id)
+	if !ok {
+		return 0, "", sql.ErrNoRows
+	}
+	return b.brand.Version, b.brand.Status, nil
+}
+
+func (m *MemoryRepository) GetBrandsAddedByUser(c context.Context, email string) ([]models.Brand, error) {
+	uid, err := m.GetIdByEmail(c, email)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	var ids []int
+	for id, b := range m.brands {
+		if b.addedBy == uid {
+			ids = append(ids, id)
+		}
+	}
+	for _, e := range m.editors {
+		if e.userId == uid && e.accepted {
+			ids = append(ids, e.brandId)
+		}
+	}
+	m.mu.RUnlock()
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	sort.Ints(ids)
+	return m.GetBrandsByIds(c, ids, true)
+}
+
+// matchesFilter the same conditions as brandConditions, skip leaves one of them out for facets
+func matchesFilter(b *memBrand, f *models.BrandFilter, skip string) bool {
+	if b.deletedAt != nil || b.brand.Status != models.PUBLISHED {
+		return false
+	}
+	if f.City != "" && skip != "city" && !strings.EqualFold(b.brand.Location, f.City) {
+		return false
+	}
+	currency := f.Currency
+	if skip == "currency" {
+		currency = ""
+	}
+	if f.PriceMin != nil || f.PriceMax != nil || currency != "" {
+		found := false
+		for _, p := range b.brand.Products {
+			if (f.PriceMin == nil || p.Price.HighEnd >= *f.PriceMin) && (f.PriceMax == nil || p.Price.LowEnd <= *f.PriceMax) &&
+				(currency == "" || p.Price.Currency == currency) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, want := range f.Contacts {
+		found := false
+		for _, c := range b.brand.Contacts {
+			if c.TypeOf.String() == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.HasStats != nil && (len(b.brand.Statistics) > 0) != *f.HasStats {
+		return false
+	}
+	return true
+}
+
+// memSortKey a brand's value of what brands are sorted by, the same as in brandSorts. text is its form in cursors
+type memSortKey struct {
+	str  string
+	num  float64
+	text string
+}
+
+func brandSortKey(b *memBrand, sortBy string) memSortKey {
+	switch strings.TrimPrefix(sortBy, "-") {
+	case "name":
+		return memSortKey{str: b.brand.Name, text: b.brand.Name}
+	case "created":
+		n := float64(b.createdAt.UnixNano())
+		return memSortKey{num: n, text: strconv.FormatInt(b.createdAt.UnixNano(), 10)}
+	case "stat":
+		v := math.Inf(-1)
+		var latest *models.StatisticMeasure
+		for i := range b.brand.Statistics {
+			s := &b.brand.Statistics[i]
+			if latest == nil || s.EndPeriod.After(latest.EndPeriod) || (s.EndPeriod.Equal(latest.EndPeriod) && s.Id > latest.Id) {
+				latest = s
+			}
+		}
+		if latest != nil {
+			v = float64(latest.Value)
+		}
+		return memSortKey{num: v, text: strconv.FormatFloat(v, 'g', -1, 64)}
+	default:
+		return memSortKey{num: float64(b.brand.Id), text: strconv.Itoa(b.brand.Id)}
+	}
+}
+
+// parseSortKey turns the text from a cursor back into a key
+func parseSortKey(text, sortBy string) (memSortKey, error) {
+	if strings.TrimPrefix(sortBy, "-") == "name" {
+		return memSortKey{str: text, text: text}, nil
+	}
+	n, err := strconv.ParseFloat(text, 64)
+	return memSortKey{num: n, text: text}, err
+}
+
+func compareKeys(a memSortKey, aId int, b memSortKey, bId int) int {
+	switch {
+	case a.str < b.str:
+		return -1
+	case a.str > b.str:
+		return 1
+	case a.num < b.num:
+		return -1
+	case a.num > b.num:
+		return 1
+	case aId < bId:
+		return -1
+	case aId > bId:
+		return 1
+	}
+	return 0
+}
+
+func (m *MemoryRepository) GetOpenBrands(_ context.Context, f *models.BrandFilter, after models.BrandCursor, limit int) ([]models.Brand, *models.BrandCursor, error) {
+	if _, ok := brandSorts[f.Sort]; !ok {
+		return nil, nil, ERRBADSORT
+	}
+	desc := strings.HasPrefix(f.Sort, "-")
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	type entry struct {
+		b   *memBrand
+		key memSortKey
+	}
+	var matched []entry
+	for _, b := range m.brands {
+		if matchesFilter(b, f, "") {
+			matched = append(matched, entry{b, brandSortKey(b, f.Sort)})
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		cmp := compareKeys(matched[i].key, matched[i].b.brand.Id, matched[j].key, matched[j].b.brand.Id)
+		if desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	if after.Id > 0 {
+		text := after.Key
+		if f.Sort == "" {
+			text = strconv.Itoa(after.Id)
+		}
+		key, err := parseSortKey(text, f.Sort)
+		if err != nil {
+			return nil, nil, err
+		}
+		start := len(matched)
+		for i, e := range matched {
+			cmp := compareKeys(e.key, e.b.brand.Id, key, after.Id)
+			if (!desc && cmp > 0) || (desc && cmp < 0) {
+				start = i
+				break
+			}
+		}
+		matched = matched[start:]
+	}
+	var next *models.BrandCursor
+	if len(matched) > limit {
+		matched = matched[:limit]
+		last := matched[limit-1]
+		next = &models.BrandCursor{Id: last.b.brand.Id, Key: last.key.text}
+	}
+	open := make([]models.Brand, len(matched))
+	for i, e := range matched {
+		open[i] = cloneBrand(&e.b.brand, true)
+	}
+	return open, next, nil
+}
+
+func (m *MemoryRepository) CountOpenBrands(_ context.Context, f *models.BrandFilter) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n := 0
+	for _, b := range m.brands {
+		if matchesFilter(b, f, "") {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryRepository) GetBrandFacets(_ context.Context, f *models.BrandFilter) (models.Facets, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	cities := make(map[string]int)
+	currencies := make(map[string]int)
+	for _, b := range m.brands {
+		if matchesFilter(b, f, "city") {
+			cities[b.brand.Location]++
+		}
+		if matchesFilter(b, f, "currency") {
+			seen := make(map[string]bool)
+			for _, p := range b.brand.Products {
+				if !seen[p.Price.Currency] {
+					seen[p.Price.Currency] = true
+					currencies[p.Price.Currency]++
+				}
+			}
+		}
+	}
+	return models.Facets{Cities: facetCounts(cities), Currencies: facetCounts(currencies)}, nil
+}
+
+// facetCounts most brands first, then by value
+func facetCounts(counts map[string]int) []models.FacetCount {
+	res := []models.FacetCount{}
+	for v, n := range counts {
+		res = append(res, models.FacetCount{Value: v, Count: n})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].Value < res[j].Value
+	})
+	return res
+}
+
+// SearchBrands every word of the query has to be somewhere in the brand; a word in the name counts most, like in the postgres search
+func (m *MemoryRepository) SearchBrands(_ context.Context, query string, offset, limit int) ([]models.SearchHit, bool, error) {
+	words := strings.Fields(strings.ToLower(query))
+	m.mu.RLock()
+	var hits []models.SearchHit
+	for _, b := range m.brands {
+		if b.deletedAt != nil || b.brand.Status != models.PUBLISHED {
+			continue
+		}
+		name, city := strings.ToLower(b.brand.Name), strings.ToLower(b.brand.Location)
+		body := strings.ToLower(b.brand.Description)
+		for _, p := range b.brand.Products {
+			body += " " + strings.ToLower(p.Name+" "+p.Description)
+		}
+		var rank float32
+		for _, w := range words {
+			switch {
+			case strings.Contains(name, w):
+				rank += 1
+			case strings.Contains(body, w):
+				rank += 0.4
+			case strings.Contains(city, w):
+				rank += 0.2
+			default:
+				rank = 0
+			}
+			if rank == 0 {
+				break
+			}
+		}
+		if rank > 0 {
+			hits = append(hits, models.SearchHit{Id: b.brand.Id, Name: b.brand.Name, Location: b.brand.Location, Rank: rank, Snippet: html.EscapeString(b.brand.Description)})
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Rank != hits[j].Rank {
+			return hits[i].Rank > hits[j].Rank
+		}
+		return hits[i].Id < hits[j].Id
+	})
+	if offset < 0 { // offsets come from client cursors
+		offset = 0
+	}
+	if offset >= len(hits) {
+		return []models.SearchHit{}, false, nil
+	}
+	hits = hits[offset:]
+	if len(hits) > limit {
+		return hits[:limit], true, nil
+	}
+	return hits, false, nil
+}
+
+// SuggestNames names that start with the prefix go first, then the ones that only contain it. Case doesn't matter, typos do
+func (m *MemoryRepository) SuggestNames(_ context.Context, prefix string, limit int) ([]models.Suggestion, error) {
+	prefix = strings.ToLower(prefix)
+	m.mu.RLock()
+	var res []models.Suggestion
+	for _, b := range m.brands {
+		if b.deletedAt != nil || b.brand.Status != models.PUBLISHED {
+			continue
+		}
+		if strings.Contains(strings.ToLower(b.brand.Name), prefix) {
+			res = append(res, models.Suggestion{Type: "brand", Id: b.brand.Id, Name: b.brand.Name, BrandId: b.brand.Id})
+		}
+		for _, p := range b.brand.Products {
+			if strings.Contains(strings.ToLower(p.Name), prefix) {
+				res = append(res, models.Suggestion{Type: "product", Id: p.Id, Name: p.Name, BrandId: b.brand.Id})
+			}
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(res, func(i, j int) bool {
+		pi, pj := strings.HasPrefix(strings.ToLower(res[i].Name), prefix), strings.HasPrefix(strings.ToLower(res[j].Name), prefix)
+		if pi != pj {
+			return pi
+		}
+		return res[i].Name < res[j].Name
+	})
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	if res == nil {
+		res = []models.Suggestion{}
+	}
+	return res, nil
+}
+
+func (m *MemoryRepository) GetBrandCreator(_ context.Context, brandId int) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.brands[brandId]
+	if !ok {
+		return -1, sql.ErrNoRows
+	}
+	return b.addedBy, nil
+}
+
+func (m *MemoryRepository) GetBrandCreatorEmail(_ context.Context, brandId int) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.brands[brandId]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	if u := m.userById(b.addedBy); u != nil {
+		return u.user.Email, nil
+	}
+	return "", nil
+}
+
+// revisionBy the user id revisions of changes by email get, -1 if there is no such user
+func (m *MemoryRepository) revisionBy(email string) int {
+	if u, ok := m.users[email]; ok {
+		return u.id
+	}
+	return -1
+}
+
+func (m *MemoryRepository) ChangeBrandStatus(_ context.Context, brandId int, changedBy string, to models.BrandStatus, reason string, from ...models.BrandStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.liveBrand(brandId)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	for _, st := range from {
+		if b.brand.Status == st {
+			b.brand.Status, b.brand.Reason = to, reason
+			b.brand.Version++
+			m.addRevision(&b.brand, m.revisionBy(changedBy))
+			return nil
+		}
+	}
+	return ERRBADSTATUS
+}
+
+func (m *MemoryRepository) GetModerationQueue(_ context.Context, offset, limit int) ([]models.Brand, bool, error) {
+	type entry struct {
+		brand     models.Brand
+		createdAt time.Time
+	}
+	// copied under the lock, edits change the stored brands in place
+	m.mu.RLock()
+	var queue []entry
+	for _, b := range m.brands {
+		if b.deletedAt == nil && b.brand.Status == models.PENDING {
+			queue = append(queue, entry{brand: models.Brand{Id: b.brand.Id, Name: b.brand.Name, Description: b.brand.Description,
+				Location: b.brand.Location, Status: b.brand.Status, Version: b.brand.Version}, createdAt: b.createdAt})
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(queue, func(i, j int) bool {
+		if !queue[i].createdAt.Equal(queue[j].createdAt) {
+			return queue[i].createdAt.Before(queue[j].createdAt)
+		}
+		return queue[i].brand.Id < queue[j].brand.Id
+	})
+	if offset < 0 { // offsets come from client cursors
+		offset = 0
+	}
+	res := []models.Brand{}
+	for i := offset; i < len(queue) && len(res) < limit; i++ {
+		res = append(res, queue[i].brand)
+	}
+	return res, offset+len(res) < len(queue), nil
+}
+
+func (m *MemoryRepository) DeleteBrand(_ context.Context, brandId int, deletedBy string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.liveBrand(brandId)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	b.deletedAt = &now
+	b.brand.Version++
+	m.addRevision(&b.brand, m.revisionBy(deletedBy))
+	return nil
+}
+
+func (m *MemoryRepository) RestoreBrand(_ context.Context, brandId int, restoredBy string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.brands[brandId]
+	if !ok || b.deletedAt == nil {
+		return sql.ErrNoRows
+	}
+	b.deletedAt = nil
+	b.brand.Version++
+	m.addRevision(&b.brand, m.revisionBy(restoredBy))
+	return nil
+}
+
+func (m *MemoryRepository) GetRevisions(_ context.Context, brandId int) ([]models.History, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	revisions := m.history[brandId]
+	res := make([]models.History, 0, len(revisions))
+	for i := len(revisions) - 1; i >= 0; i-- {
+		h := revisions[i]
+		h.Brand = nil
+		res = append(res, h)
+	}
+	return res, nil
+}
+
+func (m *MemoryRepository) GetRevision(_ context.Context, brandId, version int) (models.History, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, h := range m.history[brandId] {
+		if h.Version == version {
+			snap := cloneBrand(h.Brand, false)
+			h.Brand = &snap
+			return h, nil
+		}
+	}
+	return models.History{}, sql.ErrNoRows
+}
+
+func (m *MemoryRepository) findEditor(brandId, uid int) int {
+	for i, e := range m.editors {
+		if e.brandId == brandId && e.userId == uid {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *MemoryRepository) InviteEditor(_ context.Context, brandId int, email string, invitedBy int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[email]
+	if !ok {
+		return ERRNOUSER
+	}
+	if _, ok := m.brands[brandId]; !ok {
+		return sql.ErrNoRows
+	}
+	if m.findEditor(brandId, u.id) < 0 {
+		m.editors = append(m.editors, memEditor{brandId: brandId, userId: u.id, invitedBy: invitedBy})
+	}
+	return nil
+}
+
+func (m *MemoryRepository) AcceptInvite(_ context.Context, brandId, uid int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.findEditor(brandId, uid)
+	if i < 0 {
+		return ERRNOTEDITOR
+	}
+	m.editors[i].accepted = true
+	return nil
+}
+
+func (m *MemoryRepository) RemoveEditor(_ context.Context, brandId, uid int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i := m.findEditor(brandId, uid); i >= 0 {
+		m.editors = append(m.editors[:i], m.editors[i+1:]...)
+	}
+	return nil
+}
+
+func (m *MemoryRepository) IsBrandEditor(_ context.Context, brandId, uid int) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i := m.findEditor(brandId, uid)
+	return i >= 0 && m.editors[i].accepted, nil
+}
+
+func (m *MemoryRepository) GetBrandEditors(_ context.Context, brandId int) ([]models.Editor, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := []models.Editor{}
+	for _, e := range m.editors {
+		if e.brandId != brandId {
+			continue
+		}
+		if u := m.userById(e.userId); u != nil {
+			res = append(res, models.Editor{Email: u.user.Email, Name: u.user.Name, Surname: u.user.Surname, Accepted: e.accepted})
+		}
+	}
+	return res, nil
+}
+
+func (m *MemoryRepository) GetPendingInvites(_ context.Context, uid int) ([]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var res []int
+	for _, e := range m.editors {
+		if e.userId == uid && !e.accepted {
+			res = append(res, e.brandId)
+		}
+	}
+	return res, nil
+}
+
+func (m *MemoryRepository) TransferBrand(_ context.Context, brandId, from, to int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.findEditor(brandId, to)
+	if i < 0 || !m.editors[i].accepted {
+		return ERRNOTEDITOR
+	}
+	b, ok := m.brands[brandId]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	b.addedBy = to
+	m.editors = append(m.editors[:i], m.editors[i+1:]...)
+	if j := m.findEditor(brandId, from); j >= 0 {
+		m.editors[j].accepted = true
+	} else {
+		m.editors = append(m.editors, memEditor{brandId: brandId, userId: from, invitedBy: to, accepted: true})
+	}
+	return nil
+}
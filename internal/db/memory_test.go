@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"accelerator/internal/password"
+	"accelerator/models"
+)
+
+func newTestRepository(t *testing.T) *MemoryRepository {
+	t.Helper()
+	// the cheapest argon2id there is, tests don't need real hashes
+	m := NewMemoryRepository(&password.Hashers{Current: password.NewArgon2id(1, 8, 1)})
+	err := m.CreateUser(context.Background(), models.User{Email: "owner@example.com", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func addTestBrand(t *testing.T, m *MemoryRepository, name string, status models.BrandStatus) *models.Brand {
+	t.Helper()
+	b := &models.Brand{Name: name, Description: "tea and " + name, Location: "Moscow", Status: status}
+	err := m.AddBrand(context.Background(), b, "owner@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestMemoryNegativeOffset(t *testing.T) {
+	m := newTestRepository(t)
+	ctx := context.Background()
+	addTestBrand(t, m, "first", models.PUBLISHED)
+	addTestBrand(t, m, "second", models.PENDING)
+
+	hits, more, err := m.SearchBrands(ctx, "tea", -1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || more {
+		t.Errorf("search with offset -1: got %d hits, more=%v, want the first page", len(hits), more)
+	}
+	queue, more, err := m.GetModerationQueue(ctx, -1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 1 || more {
+		t.Errorf("queue with offset -1: got %d brands, more=%v, want the first page", len(queue), more)
+	}
+}
+
+// TestMemoryConcurrentUse is only useful with -race: readers and writers go at the same brands at once
+func TestMemoryConcurrentUse(t *testing.T) {
+	m := newTestRepository(t)
+	ctx := context.Background()
+	// enough brands for the readers to take a while over each page
+	var ids []int
+	for i := 0; i < 300; i++ {
+		ids = append(ids, addTestBrand(t, m, "brand "+strconv.Itoa(i), models.PENDING).Id)
+	}
+	var wg sync.WaitGroup
+	for _, id := range ids[:4] {
+		wg.Add(2)
+		go func(id int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				b, err := m.GetBrandForEdit(ctx, id)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				b.Description = "edited " + strconv.Itoa(i)
+				b.Version = 0
+				err = m.UpdateBrand(ctx, &b, "owner@example.com", false)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				_ = m.ChangeBrandStatus(ctx, id, "owner@example.com", models.PUBLISHED, "", models.PENDING)
+				_ = m.ChangeBrandStatus(ctx, id, "owner@example.com", models.PENDING, "", models.PUBLISHED)
+			}
+			_ = m.DeleteBrand(ctx, id, "owner@example.com")
+		}(id)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				_, _, err := m.GetModerationQueue(ctx, 0, 10)
+				if err == nil {
+					_, _, err = m.SearchBrands(ctx, "tea", 0, 10)
+				}
+				if err == nil {
+					_, _, err = m.GetOpenBrands(ctx, &models.BrandFilter{Sort: "-name"}, models.BrandCursor{}, 10)
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestMemoryModeratorEditsOwnBrand the role alone doesn't keep a published brand published, only keepStatus does
+func TestMemoryModeratorEditsOwnBrand(t *testing.T) {
+	m := newTestRepository(t)
+	ctx := context.Background()
+	err := m.SetRole(ctx, "owner@example.com", models.MODERATOR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := addTestBrand(t, m, "own", models.PUBLISHED)
+
+	b.Description = "edited by its own moderator"
+	err = m.UpdateBrand(ctx, b, "owner@example.com", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Status != models.PENDING {
+		t.Errorf("moderator's edit of their own brand left it %q, want %q", b.Status, models.PENDING)
+	}
+
+	err = m.ChangeBrandStatus(ctx, b.Id, "owner@example.com", models.PUBLISHED, "", models.PENDING)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Description = "edited by someone who may review it"
+	b.Version = 0
+	err = m.UpdateBrand(ctx, b, "owner@example.com", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Status != models.PUBLISHED {
+		t.Errorf("edit with keepStatus left the brand %q, want %q", b.Status, models.PUBLISHED)
+	}
+}
+
+// TestMemoryRevisionsWithoutGaps every version a brand had, status changes and deletion included, can be looked up
+func TestMemoryRevisionsWithoutGaps(t *testing.T) {
+	m := newTestRepository(t)
+	ctx := context.Background()
+	b := addTestBrand(t, m, "kept", models.PENDING)
+	err := m.ChangeBrandStatus(ctx, b.Id, "owner@example.com", models.REJECTED, "no contacts", models.PENDING)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.DeleteBrand(ctx, b.Id, "owner@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.RestoreBrand(ctx, b.Id, "owner@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, _, err := m.GetBrandVersion(ctx, b.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for v := 1; v <= version; v++ {
+		_, err = m.GetRevision(ctx, b.Id, v)
+		if err != nil {
+			t.Errorf("revision %d of %d: %v", v, version, err)
+		}
+	}
+	rejected, err := m.GetRevision(ctx, b.Id, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rejected.Brand.Status != models.REJECTED || rejected.Brand.Reason != "no contacts" {
+		t.Errorf("revision 2 is %q %q, want the rejection", rejected.Brand.Status, rejected.Brand.Reason)
+	}
+}
@@ -0,0 +1,253 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrations are NNNN_name.up.sql and NNNN_name.down.sql, applied in the order of NNNN. An applied file must never change,
+// anything new goes into a new one
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLock is the pg_advisory_lock key, so that instances starting at once don't migrate over each other
+const migrationLock = 5757_0001
+
+var ERRCHECKSUM = errors.New("applied migration was changed")
+
+type migration struct {
+	version  int
+	name     string
+	up, down string
+	checksum string
+}
+
+// MigrationStatus AppliedAt is nil for pending migrations
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*migration)
+	for _, e := range entries {
+		name := e.Name()
+		base, direction := strings.TrimSuffix(name, ".up.sql"), "up"
+		if strings.HasSuffix(name, ".down.sql") {
+			base, direction = strings.TrimSuffix(name, ".down.sql"), "down"
+		} else if !strings.HasSuffix(name, ".up.sql") {
+			return nil, fmt.Errorf("migration %s is neither up nor down", name)
+		}
+		num, title, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("migration %s doesn't start with a number", name)
+		}
+		data, err := migrationFiles.ReadFile("migrations/" + name)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: title}
+			byVersion[version] = m
+		}
+		if m.name != title {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.name, title)
+		}
+		if direction == "up" {
+			m.up = string(data)
+			sum := sha256.Sum256(data)
+			m.checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.down = string(data)
+		}
+	}
+	res := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %d has no up file", m.version)
+		}
+		res = append(res, *m)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].version < res[j].version })
+	return res, nil
+}
+
+type appliedMigration struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// withMigrationLock runs f on one connection holding the advisory lock, with schema_migrations in place
+func (d *Database) withMigrationLock(c context.Context, f func(conn *sql.Conn, applied map[int]appliedMigration) error) error {
+	ctx, cancel := context.WithCancel(c)
+	defer cancel()
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	// the lock belongs to the session, so everything has to go through this conn
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLock)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLock)
+		if err != nil {
+			d.log.Errorln(err)
+		}
+	}()
+	createMigrations := `CREATE TABLE IF NOT EXISTS schema_migrations(version INT PRIMARY KEY, name TEXT NOT NULL, checksum TEXT NOT NULL, applied_at TIMESTAMPTZ NOT NULL DEFAULT now())`
+	_, err = conn.ExecContext(ctx, createMigrations)
+	if err != nil {
+		return err
+	}
+	rows, err := conn.QueryContext(ctx, `SELECT version, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		err = rows.Scan(&version, &a.checksum, &a.appliedAt)
+		if err != nil {
+			_ = rows.Close()
+			return err
+		}
+		applied[version] = a
+	}
+	err = rows.Close()
+	if err != nil {
+		return err
+	}
+	return f(conn, applied)
+}
+
+// verifyChecksums every applied migration that is still around has to be exactly what was applied
+func verifyChecksums(all []migration, applied map[int]appliedMigration) error {
+	for _, m := range all {
+		a, ok := applied[m.version]
+		if ok && a.checksum != m.checksum {
+			return fmt.Errorf("%w: %04d_%s", ERRCHECKSUM, m.version, m.name)
+		}
+	}
+	return nil
+}
+
+// runMigration one file, in its own transaction together with the schema_migrations change
+func (d *Database) runMigration(ctx context.Context, conn *sql.Conn, script, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	_, err = tx.ExecContext(ctx, script) // no args, so pq sends it as is and several statements are fine
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, record, args...)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MigrateUp applies everything that isn't applied yet, gives how many were applied
+func (d *Database) MigrateUp(c context.Context) (int, error) {
+	all, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	err = d.withMigrationLock(c, func(conn *sql.Conn, applied map[int]appliedMigration) error {
+		err := verifyChecksums(all, applied)
+		if err != nil {
+			return err
+		}
+		for _, m := range all {
+			if _, ok := applied[m.version]; ok {
+				continue
+			}
+			d.log.Infof("applying migration %04d_%s", m.version, m.name)
+			err = d.runMigration(c, conn, m.up, `INSERT INTO schema_migrations(version, name, checksum) VALUES ($1, $2, $3)`, m.version, m.name, m.checksum)
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", m.version, m.name, err)
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// MigrateDown reverts the last steps applied migrations, gives how many were reverted
+func (d *Database) MigrateDown(c context.Context, steps int) (int, error) {
+	all, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	err = d.withMigrationLock(c, func(conn *sql.Conn, applied map[int]appliedMigration) error {
+		err := verifyChecksums(all, applied)
+		if err != nil {
+			return err
+		}
+		for i := len(all) - 1; i >= 0 && n < steps; i-- {
+			m := all[i]
+			if _, ok := applied[m.version]; !ok {
+				continue
+			}
+			if m.down == "" {
+				return fmt.Errorf("migration %04d_%s can't be reverted", m.version, m.name)
+			}
+			d.log.Infof("reverting migration %04d_%s", m.version, m.name)
+			err = d.runMigration(c, conn, m.down, `DELETE FROM schema_migrations WHERE version = $1`, m.version)
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", m.version, m.name, err)
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// MigrationStatus every known migration and when it was applied. Checksums are verified too
+func (d *Database) MigrationStatus(c context.Context) ([]MigrationStatus, error) {
+	all, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	var res []MigrationStatus
+	err = d.withMigrationLock(c, func(conn *sql.Conn, applied map[int]appliedMigration) error {
+		for _, m := range all {
+			st := MigrationStatus{Version: m.version, Name: m.name}
+			if a, ok := applied[m.version]; ok {
+				at := a.appliedAt
+				st.AppliedAt = &at
+			}
+			res = append(res, st)
+		}
+		return verifyChecksums(all, applied)
+	})
+	return res, err
+}
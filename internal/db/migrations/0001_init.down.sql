@@ -0,0 +1 @@
+DROP TABLE IF EXISTS media, L_Brand_Owners, Owners, History, L_Brand_Contacts, Contacts, Products, Prices, Statistics, Brands, users;
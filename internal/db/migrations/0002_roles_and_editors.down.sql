@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS brand_editors;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user';
+CREATE TABLE IF NOT EXISTS brand_editors(id SERIAL PRIMARY KEY, brand_id INT, user_id INT, invited_by INT, accepted BOOLEAN NOT NULL DEFAULT FALSE, UNIQUE (brand_id, user_id), CONSTRAINT fk_editor_brand FOREIGN KEY (brand_id) REFERENCES brands(id) ON DELETE CASCADE, CONSTRAINT fk_editor_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE, CONSTRAINT fk_editor_inviter FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE SET NULL);
@@ -0,0 +1,3 @@
+-- the default only exists for a moment, to mark everyone who registered before verification as verified
+ALTER TABLE users ADD COLUMN IF NOT EXISTS verified_at TIMESTAMP DEFAULT now();
+ALTER TABLE users ALTER COLUMN verified_at DROP DEFAULT;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS brands_search_idx;
+ALTER TABLE brands DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,8 @@
+-- has to give the same as brandSearchVector in search.go
+ALTER TABLE brands ADD COLUMN IF NOT EXISTS search_vector tsvector;
+CREATE INDEX IF NOT EXISTS brands_search_idx ON brands USING GIN (search_vector);
+UPDATE brands b SET search_vector = setweight(to_tsvector('simple', coalesce(b.name, '')), 'A') ||
+	setweight(to_tsvector('simple', coalesce(b.description, '')), 'B') ||
+	setweight(to_tsvector('simple', coalesce((SELECT string_agg(coalesce(p.name, '') || ' ' || coalesce(p.description, ''), ' ') FROM products p WHERE p.brand_id = b.id), '')), 'B') ||
+	setweight(to_tsvector('simple', coalesce(b.city, '')), 'C')
+WHERE b.search_vector IS NULL;
@@ -0,0 +1 @@
+ALTER TABLE brands DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1 @@
+ALTER TABLE brands ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
@@ -0,0 +1,4 @@
+-- the extensions stay, something else could be using them
+DROP INDEX IF EXISTS products_name_trgm_idx;
+DROP INDEX IF EXISTS brands_name_trgm_idx;
+DROP FUNCTION IF EXISTS immutable_unaccent(text);
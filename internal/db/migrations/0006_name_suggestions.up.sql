@@ -0,0 +1,6 @@
+-- suggestions ignore case and accents and forgive typos; unaccent isn't immutable by itself, so it can't go into an index without a wrapper
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE EXTENSION IF NOT EXISTS unaccent;
+CREATE OR REPLACE FUNCTION immutable_unaccent(text) RETURNS text AS $$ SELECT public.unaccent('public.unaccent', $1) $$ LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT;
+CREATE INDEX IF NOT EXISTS brands_name_trgm_idx ON brands USING GIN (immutable_unaccent(lower(name)) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS products_name_trgm_idx ON products USING GIN (immutable_unaccent(lower(name)) gin_trgm_ops);
@@ -0,0 +1,2 @@
+-- bumped on every change of the brand, clients get it as ETag
+ALTER TABLE brands ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS history_brand_version_idx;
+ALTER TABLE History DROP COLUMN IF EXISTS snapshot, DROP COLUMN IF EXISTS created_at, DROP COLUMN IF EXISTS edited_by,
+	DROP COLUMN IF EXISTS version, DROP COLUMN IF EXISTS brand_id;
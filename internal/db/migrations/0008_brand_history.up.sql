@@ -0,0 +1,7 @@
+-- a snapshot of the brand after every add and edit, images aren't there
+ALTER TABLE History ADD COLUMN IF NOT EXISTS brand_id INT REFERENCES brands(id) ON DELETE CASCADE,
+	ADD COLUMN IF NOT EXISTS version INT,
+	ADD COLUMN IF NOT EXISTS edited_by INT REFERENCES users(id) ON DELETE SET NULL,
+	ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	ADD COLUMN IF NOT EXISTS snapshot JSONB;
+CREATE UNIQUE INDEX IF NOT EXISTS history_brand_version_idx ON History (brand_id, version);
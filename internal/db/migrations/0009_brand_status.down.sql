@@ -0,0 +1,4 @@
+ALTER TABLE brands ADD COLUMN IF NOT EXISTS is_open BOOLEAN;
+UPDATE brands SET is_open = status = 'published';
+DROP INDEX IF EXISTS brands_status_idx;
+ALTER TABLE brands DROP COLUMN IF EXISTS status_reason, DROP COLUMN IF EXISTS status;
@@ -0,0 +1,11 @@
+-- is_open became status: open brands were out already, closed ones still wait for a moderator
+ALTER TABLE brands ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'draft'
+	CHECK (status IN ('draft', 'pending_review', 'published', 'rejected', 'archived')),
+	ADD COLUMN IF NOT EXISTS status_reason TEXT NOT NULL DEFAULT '';
+DO $$ BEGIN
+	IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'brands' AND column_name = 'is_open') THEN
+		UPDATE brands SET status = CASE WHEN is_open THEN 'published' ELSE 'pending_review' END;
+		ALTER TABLE brands DROP COLUMN is_open;
+	END IF;
+END $$;
+CREATE INDEX IF NOT EXISTS brands_status_idx ON brands (status);
@@ -0,0 +1,4 @@
+-- brands that are deleted right now would come back, so they go for good
+DELETE FROM brands WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS brands_deleted_at_idx;
+ALTER TABLE brands DROP COLUMN IF EXISTS deleted_at;
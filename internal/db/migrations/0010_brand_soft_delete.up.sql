@@ -0,0 +1,3 @@
+-- deleted brands stay for a while, so that they can be restored
+ALTER TABLE brands ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS brands_deleted_at_idx ON brands (deleted_at) WHERE deleted_at IS NOT NULL;
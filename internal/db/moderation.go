@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"accelerator/models"
+	"github.com/lib/pq"
+)
+
+var ERRBADSTATUS = errors.New("brand can't get this status from the one it has")
+
+// ChangeBrandStatus moves the brand to status to, but only if it is in one of from right now, otherwise it's ERRBADSTATUS.
+// reason is kept for rejections, the other statuses clear it. The change is saved as a revision by changedBy
+func (d *Database) ChangeBrandStatus(c context.Context, brandId int, changedBy string, to models.BrandStatus, reason string, from ...models.BrandStatus) error {
+	changeStatus := `UPDATE brands SET status = $1, status_reason = $2, version = version + 1 WHERE id = $3 AND status = ANY($4) AND deleted_at IS NULL`
+	allowed := make([]string, len(from))
+	for i, st := range from {
+		allowed[i] = string(st)
+	}
+	err := d.changeBrand(c, brandId, changedBy, changeStatus, to, reason, brandId, pq.Array(allowed))
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	_, _, err = d.GetBrandVersion(c, brandId)
+	if err != nil {
+		return err // sql.ErrNoRows if there is no such brand
+	}
+	return ERRBADSTATUS
+}
+
+// GetModerationQueue brands waiting for review, the ones waiting longest first. Only core info, the rest is in GetBrandById
+func (d *Database) GetModerationQueue(c context.Context, offset, limit int) ([]models.Brand, bool, error) {
+	getQueue := `SELECT id, name, description, city, status, version FROM brands WHERE status = 'pending_review' AND deleted_at IS NULL
+		ORDER BY created_at, id OFFSET $1 LIMIT $2`
+	rows, err := d.db.QueryContext(c, getQueue, offset, limit+1) // one more to know if there's a next page
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() { _ = rows.Close() }()
+	res := []models.Brand{}
+	for rows.Next() {
+		var b models.Brand
+		err = rows.Scan(&b.Id, &b.Name, &b.Description, &b.Location, &b.Status, &b.Version)
+		if err != nil {
+			return nil, false, err
+		}
+		res = append(res, b)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(res) > limit {
+		return res[:limit], true, nil
+	}
+	return res, false, nil
+}
+
+// GetBrandCreatorEmail empty if the account is gone
+func (d *Database) GetBrandCreatorEmail(c context.Context, brandId int) (string, error) {
+	var email sql.NullString
+	getEmail := `SELECT u.email FROM brands b LEFT JOIN users u ON u.id = b.added_by WHERE b.id = $1`
+	err := d.db.QueryRowContext(c, getEmail, brandId).Scan(&email)
+	return email.String, err
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+
+	"accelerator/models"
+)
+
+// UserRepository is everything the server needs to know about accounts. Unknown emails give ERRNOUSER
+type UserRepository interface {
+	CreateUser(c context.Context, u models.User) error
+	IsVerified(c context.Context, mail string) (bool, error)
+	SetVerified(c context.Context, mail string) error
+	CheckPassword(c context.Context, mail, passwd string) (bool, error)
+	SetPassword(c context.Context, mail, passwd string) error
+	GetIdByEmail(c context.Context, mail string) (int, error)
+	GetPasswordByEmail(c context.Context, mail string) (string, error)
+	GetRoleByEmail(c context.Context, mail string) (models.Role, error)
+	SetRole(c context.Context, mail string, role models.Role) error
+}
+
+// BrandRepository is everything about brands: the catalog, editing, moderation, history and editors.
+// Missing brands give sql.ErrNoRows, the same as with postgres
+type BrandRepository interface {
+	AddBrand(c context.Context, b *models.Brand, addedBy string) error
+	UpdateBrand(c context.Context, b *models.Brand, editedBy string, keepStatus bool) error
+	GetBrandById(c context.Context, id int) (models.Brand, error)
+	GetBrandForEdit(c context.Context, id int) (models.Brand, error)
+	GetBrandsByIds(c context.Context, ids []int, withMedia bool) ([]models.Brand, error)
+	GetBrandIdByName(c context.Context, name string) (int, error)
+	GetBrandVersion(c context.Context, id int) (int, models.BrandStatus, error)
+	GetBrandsAddedByUser(c context.Context, email string) ([]models.Brand, error)
+
+	GetOpenBrands(c context.Context, f *models.BrandFilter, after models.BrandCursor, limit int) ([]models.Brand, *models.BrandCursor, error)
+	CountOpenBrands(c context.Context, f *models.BrandFilter) (int, error)
+	GetBrandFacets(c context.Context, f *models.BrandFilter) (models.Facets, error)
+	SearchBrands(c context.Context, query string, offset, limit int) ([]models.SearchHit, bool, error)
+	SuggestNames(c context.Context, prefix string, limit int) ([]models.Suggestion, error)
+
+	GetBrandCreator(c context.Context, brandId int) (int, error)
+	GetBrandCreatorEmail(c context.Context, brandId int) (string, error)
+	ChangeBrandStatus(c context.Context, brandId int, changedBy string, to models.BrandStatus, reason string, from ...models.BrandStatus) error
+	GetModerationQueue(c context.Context, offset, limit int) ([]models.Brand, bool, error)
+	DeleteBrand(c context.Context, brandId int, deletedBy string) error
+	RestoreBrand(c context.Context, brandId int, restoredBy string) error
+
+	GetRevisions(c context.Context, brandId int) ([]models.History, error)
+	GetRevision(c context.Context, brandId, version int) (models.History, error)
+
+	InviteEditor(c context.Context, brandId int, email string, invitedBy int) error
+	AcceptInvite(c context.Context, brandId, uid int) error
+	RemoveEditor(c context.Context, brandId, uid int) error
+	IsBrandEditor(c context.Context, brandId, uid int) (bool, error)
+	GetBrandEditors(c context.Context, brandId int) ([]models.Editor, error)
+	GetPendingInvites(c context.Context, uid int) ([]int, error)
+	TransferBrand(c context.Context, brandId, from, to int) error
+}
+
+var (
+	_ UserRepository  = (*Database)(nil)
+	_ BrandRepository = (*Database)(nil)
+	_ UserRepository  = (*MemoryRepository)(nil)
+	_ BrandRepository = (*MemoryRepository)(nil)
+)
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"accelerator/models"
+)
+
+var ERRNOUSER = errors.New("there is no user with this email")
+
+func (d *Database) GetRoleByEmail(c context.Context, mail string) (models.Role, error) {
+	getRole := `SELECT role FROM users WHERE email = $1`
+	var role string
+	err := d.db.QueryRowContext(c, getRole, mail).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.USER, ERRNOUSER
+	}
+	if err != nil {
+		return models.USER, err
+	}
+	r, _ := models.NewRole(role)
+	return r, nil
+}
+
+func (d *Database) SetRole(c context.Context, mail string, role models.Role) error {
+	setRole := `UPDATE users SET role = $1 WHERE email = $2`
+	res, err := d.db.ExecContext(c, setRole, role.String(), mail)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ERRNOUSER
+	}
+	return nil
+}
+
+// GetBrandCreator gives the id of the user who added the brand
+func (d *Database) GetBrandCreator(c context.Context, brandId int) (int, error) {
+	var added sql.NullInt64 // creator's account could have been deleted
+	getBrandCreator := `SELECT added_by FROM brands WHERE id = $1`
+	err := d.db.QueryRowContext(c, getBrandCreator, brandId).Scan(&added)
+	if err != nil {
+		return -1, err
+	}
+	if !added.Valid {
+		return -1, nil
+	}
+	return int(added.Int64), nil
+}
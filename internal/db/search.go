@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"accelerator/models"
+)
+
+// brandSearchVector is what full-text search looks through, for the brand aliased as b. The name weighs most, then what the brand is and sells.
+// 'simple' doesn't stem anything, which is the safest bet while brands are written in more than one language.
+// Migration 0004 has a copy of it, a change here needs a new migration to refill old brands
+const brandSearchVector = `setweight(to_tsvector('simple', coalesce(b.name, '')), 'A') ||
+	setweight(to_tsvector('simple', coalesce(b.description, '')), 'B') ||
+	setweight(to_tsvector('simple', coalesce((SELECT string_agg(coalesce(p.name, '') || ' ' || coalesce(p.description, ''), ' ') FROM products p WHERE p.brand_id = b.id), '')), 'B') ||
+	setweight(to_tsvector('simple', coalesce(b.city, '')), 'C')`
+
+// updateSearchVector has to run after the brand or its products change; operates within the transaction
+func (d *Database) updateSearchVector(ctx context.Context, tx *sql.Tx, brandId int) error {
+	_, err := tx.ExecContext(ctx, `UPDATE brands b SET search_vector = `+brandSearchVector+` WHERE b.id = $1`, brandId)
+	return err
+}
+
+// snippetSource is the text snippets are cut from, already HTML-escaped, since ts_headline puts <b></b> around matches and leaves the rest as it is
+const snippetSource = `replace(replace(replace(coalesce(b.description, '') || ' ' || coalesce((SELECT string_agg(coalesce(p.name, '') || ' ' || coalesce(p.description, ''), ' ') FROM products p WHERE p.brand_id = b.id), ''),
+	'&', '&amp;'), '<', '&lt;'), '>', '&gt;')`
+
+// SearchBrands gives open brands matching the query, best first. The query is in the same syntax web search engines use
+func (d *Database) SearchBrands(c context.Context, query string, offset, limit int) (hits []models.SearchHit, more bool, err error) {
+	search := `SELECT b.id, b.name, b.city, ts_rank(b.search_vector, q) AS rank,
+		ts_headline('simple', ` + snippetSource + `, q, 'MaxFragments=2, MaxWords=20, MinWords=5')
+		FROM brands b, websearch_to_tsquery('simple', $1) q
+		WHERE b.status = 'published' AND b.deleted_at IS NULL AND b.search_vector @@ q
+		ORDER BY rank DESC, b.id LIMIT $2 OFFSET $3`
+	rows, err := d.db.QueryContext(c, search, query, limit+1, offset)
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() { _ = rows.Close() }()
+	hits = []models.SearchHit{}
+	for rows.Next() {
+		var h models.SearchHit
+		var city sql.NullString
+		err = rows.Scan(&h.Id, &h.Name, &city, &h.Rank, &h.Snippet)
+		if err != nil {
+			return nil, false, err
+		}
+		h.Location = city.String
+		hits = append(hits, h)
+	}
+	if len(hits) > limit {
+		hits, more = hits[:limit], true
+	}
+	return hits, more, rows.Err()
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"strings"
+
+	"accelerator/models"
+)
+
+// likeEscaper keeps user input from being read as LIKE wildcards
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SuggestNames gives open brands and their products whose names start with the prefix or are close enough to it.
+// Case and accents don't matter; prefix matches go first, then the most similar ones
+func (d *Database) SuggestNames(c context.Context, prefix string, limit int) ([]models.Suggestion, error) {
+	suggest := `SELECT kind, id, name, brand_id FROM (
+			SELECT 'brand' AS kind, b.id, b.name, b.id AS brand_id, immutable_unaccent(lower(b.name)) AS norm FROM brands b
+			WHERE b.status = 'published' AND b.deleted_at IS NULL AND (immutable_unaccent(lower(b.name)) LIKE immutable_unaccent(lower($1)) || '%' OR immutable_unaccent(lower(b.name)) % immutable_unaccent(lower($2)))
+			UNION ALL
+			SELECT 'product', p.id, p.name, p.brand_id, immutable_unaccent(lower(p.name)) FROM products p JOIN brands b ON b.id = p.brand_id
+			WHERE b.status = 'published' AND b.deleted_at IS NULL AND (immutable_unaccent(lower(p.name)) LIKE immutable_unaccent(lower($1)) || '%' OR immutable_unaccent(lower(p.name)) % immutable_unaccent(lower($2)))
+		) s
+		ORDER BY s.norm LIKE immutable_unaccent(lower($1)) || '%' DESC, similarity(s.norm, immutable_unaccent(lower($2))) DESC, s.name
+		LIMIT $3`
+	rows, err := d.db.QueryContext(c, suggest, likeEscaper.Replace(prefix), prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	res := []models.Suggestion{}
+	for rows.Next() {
+		var sg models.Suggestion
+		err = rows.Scan(&sg.Type, &sg.Id, &sg.Name, &sg.BrandId)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, sg)
+	}
+	return res, rows.Err()
+}
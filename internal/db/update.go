@@ -0,0 +1,487 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	fileWorker "accelerator/internal/mediaworker"
+	"accelerator/models"
+	"github.com/lib/pq"
+)
+
+const dateLayout = "2006-01-02"
+
+// storedProduct is a product row together with its price, as it is in the db right now
+type storedProduct struct {
+	name, description string
+	price             models.Price
+}
+
+// UpdateBrand changes the brand in place instead of recreating it. Children are matched to the stored ones by id:
+// changed ones are updated, ones without a known id are inserted, and the stored ones that weren't sent are deleted.
+// Product images that come back the same as GetBrandById gave them are kept; a product sent without images keeps the ones it has.
+// Ids of inserted children are written back into b. Whether the user may do this is up to the caller.
+// If b.Version isn't 0 the brand has to still be at that version, otherwise it's ERRSTALE; b.Version gets the new one.
+// The result is saved as a revision by editedBy. b.Status is ignored: an edited published or rejected brand goes back to review,
+// unless keepStatus says editedBy could review it themselves (see authorizeReview in the server). b gets the status the brand ends up with
+func (d *Database) UpdateBrand(c context.Context, b *models.Brand, editedBy string, keepStatus bool) error {
+	ctx, cancel := context.WithCancel(c)
+	defer cancel()
+	uid, err := d.GetIdByEmail(c, editedBy)
+	if err != nil {
+		return err
+	}
+	updateCoreInfo := `UPDATE brands SET name = $1, description = $2, city = $3, version = version + 1,
+		status = CASE WHEN $4 AND status IN ('published', 'rejected') THEN 'pending_review' ELSE status END
+		WHERE id = $5 AND ($6 = 0 OR version = $6) AND deleted_at IS NULL RETURNING version, status, status_reason`
+	// transaction begins here
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = tx.QueryRowContext(ctx, updateCoreInfo, b.Name, b.Description, b.Location, !keepStatus, b.Id, b.Version).Scan(&b.Version, &b.Status, &b.Reason)
+	if errors.Is(err, sql.ErrNoRows) && b.Version != 0 {
+		var exists bool
+		err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM brands WHERE id = $1 AND deleted_at IS NULL)`, b.Id).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ERRSTALE
+		}
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return err
+	}
+	// everything that's new is collected here and then inserted the same way AddBrand does it
+	fresh := models.Brand{Id: b.Id}
+	freshContacts, err := d.updateContacts(ctx, tx, b)
+	if err != nil {
+		return err
+	}
+	for _, i := range freshContacts {
+		fresh.AppendContact(b.Contacts[i])
+	}
+	freshOwners, err := d.updateOwners(ctx, tx, b)
+	if err != nil {
+		return err
+	}
+	for _, i := range freshOwners {
+		fresh.AppendOwner(b.Owners[i])
+	}
+	freshStats, err := d.updateStatistics(ctx, tx, b)
+	if err != nil {
+		return err
+	}
+	for _, i := range freshStats {
+		fresh.AppendStat(b.Statistics[i])
+	}
+	freshProducts, orphans, err := d.updateProducts(ctx, tx, b)
+	if err != nil {
+		return err
+	}
+	for _, i := range freshProducts {
+		fresh.AppendProduct(b.Products[i])
+	}
+	err = d.addAllInfoAfterCore(ctx, tx, &fresh)
+	if err != nil {
+		return err
+	}
+	for j, i := range freshContacts {
+		b.Contacts[i].Id = fresh.Contacts[j].Id
+	}
+	for j, i := range freshOwners {
+		b.Owners[i].Id = fresh.Owners[j].Id
+	}
+	for j, i := range freshStats {
+		b.Statistics[i].Id = fresh.Statistics[j].Id
+	}
+	for j, i := range freshProducts {
+		b.Products[i].Id = fresh.Products[j].Id
+		b.Products[i].Price.Id = fresh.Products[j].Price.Id
+	}
+	err = d.updateSearchVector(ctx, tx, b.Id)
+	if err != nil {
+		return err
+	}
+	err = d.addRevision(ctx, tx, b, uid)
+	if err != nil {
+		return err
+	}
+	// transaction committed, done
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	// files go only after the rows are gone for sure
+	for _, path := range orphans {
+		err = d.fileWorker.DeleteFile(path)
+		if err != nil {
+			d.log.Errorln(err)
+		}
+	}
+	return nil
+}
+
+// splitChildren sorts the incoming ids: kept and fresh are indices of ones the brand already has and of new ones,
+// gone are stored ids nobody sent. An id the brand doesn't have, or one sent twice, counts as new
+func splitChildren(incoming []int, stored []int) (kept, fresh, gone []int) {
+	known := make(map[int]bool, len(stored))
+	for _, id := range stored {
+		known[id] = true
+	}
+	for i, id := range incoming {
+		if known[id] {
+			kept = append(kept, i)
+			delete(known, id)
+		} else {
+			fresh = append(fresh, i)
+		}
+	}
+	for _, id := range stored {
+		if known[id] {
+			gone = append(gone, id)
+		}
+	}
+	return kept, fresh, gone
+}
+
+// updateContacts updates and deletes contacts of the brand, gives back indices of the ones to insert
+func (d *Database) updateContacts(ctx context.Context, tx *sql.Tx, b *models.Brand) ([]int, error) {
+	getContacts := `SELECT c.id, c.type, c.contact FROM contacts c JOIN l_brand_contacts l ON l.contact_id = c.id WHERE l.brand_id = $1`
+	rows, err := tx.QueryContext(ctx, getContacts, b.Id)
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[int]models.Contact)
+	var storedIds []int
+	for rows.Next() {
+		var id int
+		var curtype, curlink string
+		err = rows.Scan(&id, &curtype, &curlink)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		stored[id] = models.NewContact(curtype, curlink)
+		storedIds = append(storedIds, id)
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	incoming := make([]int, len(b.Contacts))
+	for i := range b.Contacts {
+		incoming[i] = b.Contacts[i].Id
+	}
+	kept, fresh, gone := splitChildren(incoming, storedIds)
+	changed := models.Brand{}
+	var changedIds []int
+	for _, i := range kept {
+		cur, old := b.Contacts[i], stored[b.Contacts[i].Id]
+		if cur.TypeOf != old.TypeOf || cur.Link != old.Link {
+			changed.AppendContact(cur)
+			changedIds = append(changedIds, cur.Id)
+		}
+	}
+	if len(changedIds) > 0 {
+		updateContacts := `UPDATE contacts AS c SET type = v.type, contact = v.contact FROM (VALUES ?) AS v(id, type, contact) WHERE c.id = v.id`
+		updateContacts, args := changed.GetBulkUpdateStatementContacts(updateContacts, changedIds)
+		d.log.Debug(updateContacts)
+		_, err = tx.ExecContext(ctx, updateContacts, args...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(gone) > 0 {
+		_, err = tx.ExecContext(ctx, `DELETE FROM contacts WHERE id = ANY($1)`, pq.Array(gone))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fresh, nil
+}
+
+// updateOwners same as updateContacts, but for owners
+func (d *Database) updateOwners(ctx context.Context, tx *sql.Tx, b *models.Brand) ([]int, error) {
+	getOwners := `SELECT o.id, o.name, o.surname, o.fathername, o.bio_info FROM owners o JOIN l_brand_owners l ON l.owner_id = o.id WHERE l.brand_id = $1`
+	rows, err := tx.QueryContext(ctx, getOwners, b.Id)
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[int]models.Person)
+	var storedIds []int
+	for rows.Next() {
+		var id int
+		var cur models.Person
+		err = rows.Scan(&id, &cur.Name, &cur.Surname, &cur.Fathername, &cur.BioInfo)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		stored[id] = cur
+		storedIds = append(storedIds, id)
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	incoming := make([]int, len(b.Owners))
+	for i := range b.Owners {
+		incoming[i] = b.Owners[i].Id
+	}
+	kept, fresh, gone := splitChildren(incoming, storedIds)
+	changed := models.Brand{}
+	var changedIds []int
+	for _, i := range kept {
+		cur := b.Owners[i]
+		if cur.Per != stored[cur.Id] {
+			changed.AppendOwner(cur)
+			changedIds = append(changedIds, cur.Id)
+		}
+	}
+	if len(changedIds) > 0 {
+		updateOwners := `UPDATE owners AS o SET name = v.name, surname = v.surname, fathername = v.fathername, bio_info = v.bio_info FROM (VALUES ?) AS v(id, name, surname, fathername, bio_info) WHERE o.id = v.id`
+		updateOwners, args := changed.GetBulkUpdateStatementOwners(updateOwners, changedIds)
+		d.log.Debug(updateOwners)
+		_, err = tx.ExecContext(ctx, updateOwners, args...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(gone) > 0 {
+		_, err = tx.ExecContext(ctx, `DELETE FROM owners WHERE id = ANY($1)`, pq.Array(gone))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fresh, nil
+}
+
+// updateStatistics same as updateContacts, but for statistics. Periods are dates, so only dates are compared
+func (d *Database) updateStatistics(ctx context.Context, tx *sql.Tx, b *models.Brand) ([]int, error) {
+	getStats := `SELECT id, name, description, start_time, end_time, value FROM statistics WHERE brand_id = $1`
+	rows, err := tx.QueryContext(ctx, getStats, b.Id)
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[int]models.StatisticMeasure)
+	var storedIds []int
+	for rows.Next() {
+		var stat models.StatisticMeasure
+		err = rows.Scan(&stat.Id, &stat.Name, &stat.Description, &stat.StartPeriod, &stat.EndPeriod, &stat.Value)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		stored[stat.Id] = stat
+		storedIds = append(storedIds, stat.Id)
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	incoming := make([]int, len(b.Statistics))
+	for i := range b.Statistics {
+		incoming[i] = b.Statistics[i].Id
+	}
+	kept, fresh, gone := splitChildren(incoming, storedIds)
+	changed := models.Brand{}
+	var changedIds []int
+	for _, i := range kept {
+		cur, old := b.Statistics[i], stored[b.Statistics[i].Id]
+		if cur.Name != old.Name || cur.Description != old.Description || cur.Value != old.Value ||
+			cur.StartPeriod.Format(dateLayout) != old.StartPeriod.Format(dateLayout) || cur.EndPeriod.Format(dateLayout) != old.EndPeriod.Format(dateLayout) {
+			changed.AppendStat(cur)
+			changedIds = append(changedIds, cur.Id)
+		}
+	}
+	if len(changedIds) > 0 {
+		updateStats := `UPDATE statistics AS s SET start_time = v.start_time, end_time = v.end_time, name = v.name, description = v.description, value = v.value
+			FROM (VALUES ?) AS v(id, start_time, end_time, name, description, value) WHERE s.id = v.id`
+		updateStats, args := changed.GetBulkUpdateStatementStats(updateStats, changedIds)
+		d.log.Debug(updateStats)
+		_, err = tx.ExecContext(ctx, updateStats, args...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(gone) > 0 {
+		_, err = tx.ExecContext(ctx, `DELETE FROM statistics WHERE id = ANY($1)`, pq.Array(gone))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fresh, nil
+}
+
+// updateProducts same as updateContacts, but products also have prices and images.
+// orphans are paths of image files that nothing points at anymore, they can be deleted once the transaction is committed
+func (d *Database) updateProducts(ctx context.Context, tx *sql.Tx, b *models.Brand) (fresh []int, orphans []string, err error) {
+	getProducts := `SELECT p.id, p.name, p.description, p.price_id, pr.low_end, pr.high_end, pr.currency FROM products p JOIN prices pr ON pr.id = p.price_id WHERE p.brand_id = $1`
+	rows, err := tx.QueryContext(ctx, getProducts, b.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+	stored := make(map[int]storedProduct)
+	var storedIds []int
+	for rows.Next() {
+		var id int
+		var cur storedProduct
+		err = rows.Scan(&id, &cur.name, &cur.description, &cur.price.Id, &cur.price.LowEnd, &cur.price.HighEnd, &cur.price.Currency)
+		if err != nil {
+			_ = rows.Close()
+			return nil, nil, err
+		}
+		stored[id] = cur
+		storedIds = append(storedIds, id)
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	incoming := make([]int, len(b.Products))
+	for i := range b.Products {
+		incoming[i] = b.Products[i].Id
+	}
+	kept, fresh, gone := splitChildren(incoming, storedIds)
+	changedProducts, changedPrices := models.Brand{}, models.Brand{}
+	var changedProductIds, changedPriceIds []int
+	for _, i := range kept {
+		p := &b.Products[i]
+		old := stored[p.Id]
+		p.Price.Id = old.price.Id // whatever the client says, the product keeps its own price row
+		if p.Name != old.name || p.Description != old.description {
+			changedProducts.AppendProduct(*p)
+			changedProductIds = append(changedProductIds, p.Id)
+		}
+		if p.Price != old.price {
+			changedPrices.AppendProduct(*p)
+			changedPriceIds = append(changedPriceIds, p.Price.Id)
+		}
+		if p.Media != nil {
+			gonePaths, err := d.syncImages(ctx, tx, p)
+			if err != nil {
+				return nil, nil, err
+			}
+			orphans = append(orphans, gonePaths...)
+		}
+	}
+	if len(changedProductIds) > 0 {
+		updateProducts := `UPDATE products AS p SET name = v.name, description = v.description FROM (VALUES ?) AS v(id, name, description) WHERE p.id = v.id`
+		updateProducts, args := changedProducts.GetBulkUpdateStatementProducts(updateProducts, changedProductIds)
+		d.log.Debug(updateProducts)
+		_, err = tx.ExecContext(ctx, updateProducts, args...)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(changedPriceIds) > 0 {
+		updatePrices := `UPDATE prices AS p SET low_end = v.low_end, high_end = v.high_end, currency = v.currency FROM (VALUES ?) AS v(id, low_end, high_end, currency) WHERE p.id = v.id`
+		updatePrices, args := changedPrices.GetBulkUpdateStatementPrices(updatePrices, changedPriceIds)
+		d.log.Debug(updatePrices)
+		_, err = tx.ExecContext(ctx, updatePrices, args...)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(gone) > 0 {
+		rows, err = tx.QueryContext(ctx, `SELECT path FROM media WHERE product_id = ANY($1)`, pq.Array(gone))
+		if err != nil {
+			return nil, nil, err
+		}
+		paths, err := collectStrings(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		orphans = append(orphans, paths...)
+		// media goes with products, and products go with their prices
+		deletePrices := `DELETE FROM prices WHERE id IN (SELECT price_id FROM products WHERE id = ANY($1))`
+		_, err = tx.ExecContext(ctx, deletePrices, pq.Array(gone))
+		if err != nil {
+			return nil, nil, err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM products WHERE id = ANY($1)`, pq.Array(gone))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return fresh, orphans, nil
+}
+
+// syncImages keeps stored images that were sent back unchanged, saves the new ones and unlinks the rest.
+// Gives back the paths of unlinked files. Operates within the transaction
+func (d *Database) syncImages(ctx context.Context, tx *sql.Tx, p *models.Product) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id, path FROM media WHERE product_id = $1`, p.Id)
+	if err != nil {
+		return nil, err
+	}
+	type media struct {
+		id   int
+		path string
+	}
+	var stored []media
+	for rows.Next() {
+		var m media
+		err = rows.Scan(&m.id, &m.path)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		stored = append(stored, m)
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	// images are sent as data urls, so the stored ones are turned into exactly what GetBrandById would give
+	byContent := make(map[string][]media)
+	var goneIds []int
+	var gonePaths []string
+	for _, m := range stored {
+		img, err := d.fileWorker.LoadFile(m.path)
+		if err != nil { // the file is lost anyway
+			d.log.Errorln(err)
+			goneIds, gonePaths = append(goneIds, m.id), append(gonePaths, m.path)
+			continue
+		}
+		url := "data:image/jpeg;base64," + fileWorker.ImageToString(img)
+		byContent[url] = append(byContent[url], m)
+	}
+	added := models.Product{Id: p.Id}
+	for _, url := range p.Media {
+		if same := byContent[url]; len(same) > 0 {
+			byContent[url] = same[1:]
+			continue
+		}
+		added.Media = append(added.Media, url)
+	}
+	for _, left := range byContent {
+		for _, m := range left {
+			goneIds, gonePaths = append(goneIds, m.id), append(gonePaths, m.path)
+		}
+	}
+	if len(goneIds) > 0 {
+		_, err = tx.ExecContext(ctx, `DELETE FROM media WHERE id = ANY($1)`, pq.Array(goneIds))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return gonePaths, d.addImages(ctx, tx, &added)
+}
+
+func collectStrings(rows *sql.Rows) ([]string, error) {
+	defer func() { _ = rows.Close() }()
+	var res []string
+	for rows.Next() {
+		var s string
+		err := rows.Scan(&s)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,62 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(m Message) error
+}
+
+// NewMailer there is no real smtp yet, so it's either the log or an outbox directory, both are for development
+func NewMailer(kind, outbox string, log *log.Logger) (Mailer, error) {
+	switch kind {
+	case "file":
+		err := os.MkdirAll(outbox, 0755)
+		if err != nil {
+			return nil, err
+		}
+		return &FileMailer{dir: outbox}, nil
+	default:
+		return &LogMailer{log: log}, nil
+	}
+}
+
+// LogMailer writes messages to the log instead of sending them
+type LogMailer struct {
+	log *log.Logger
+}
+
+func (l *LogMailer) Send(m Message) error {
+	l.log.Infof("mail to %s: %s\n%s", m.To, m.Subject, m.Body)
+	return nil
+}
+
+// FileMailer puts every message into its own file in the outbox directory
+type FileMailer struct {
+	mu  sync.Mutex
+	dir string
+	cnt int
+}
+
+func (f *FileMailer) Send(m Message) error {
+	f.mu.Lock()
+	f.cnt++
+	name := fmt.Sprintf("%d-%d-%s.eml", time.Now().UnixNano(), f.cnt, strings.ReplaceAll(m.To, string(os.PathSeparator), "_"))
+	f.mu.Unlock()
+	content := fmt.Sprintf("To: %s\r\nSubject: %s\r\n\r\n%s\r\n", m.To, m.Subject, m.Body)
+	return os.WriteFile(filepath.Join(f.dir, name), []byte(content), 0644)
+}
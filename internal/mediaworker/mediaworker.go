@@ -3,6 +3,7 @@ package mediaworker
 import (
 	"bytes"
 	"encoding/base64"
+	"errors"
 	"image"
 	"image/jpeg"
 	"io/fs"
@@ -17,6 +18,7 @@ import (
 type MediaWorker interface {
 	SaveFile(img image.Image) (string, error)
 	LoadFile(path string) (image.Image, error)
+	DeleteFile(path string) error
 }
 
 type SimpleFileWorker struct {
@@ -70,6 +72,14 @@ func (s *SimpleFileWorker) LoadFile(path string) (image.Image, error) {
 	return img, err
 }
 
+func (s *SimpleFileWorker) DeleteFile(path string) error {
+	err := os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) { // nothing to delete is fine
+		return nil
+	}
+	return err
+}
+
 func ImageToString(img image.Image) string {
 	buf := new(bytes.Buffer)
 	err := jpeg.Encode(buf, img, nil)
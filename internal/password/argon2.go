@@ -0,0 +1,123 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+// Argon2id stores hashes in PHC string format: $argon2id$v=19$m=<KiB>,t=<passes>,p=<threads>$<salt>$<hash>
+type Argon2id struct {
+	Time    uint32
+	Memory  uint32 // in KiB
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+// NewArgon2id zero values are replaced with the OWASP recommended minimum
+func NewArgon2id(time, memory uint32, threads uint8) *Argon2id {
+	h := &Argon2id{Time: time, Memory: memory, Threads: threads, KeyLen: 32, SaltLen: 16}
+	if h.Time == 0 {
+		h.Time = 2
+	}
+	if h.Memory == 0 {
+		h.Memory = 19 * 1024
+	}
+	if h.Threads == 0 {
+		h.Threads = 1
+	}
+	return h
+}
+
+func (a *Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, a.KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, a.Memory, a.Time, a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a *Argon2id) Verify(password, encoded string) (bool, error) {
+	p, err := parseArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+}
+
+func (a *Argon2id) Owns(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+func (a *Argon2id) Outdated(encoded string) bool {
+	p, err := parseArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return p.version != argon2.Version || p.time != a.Time || p.memory != a.Memory || p.threads != a.Threads ||
+		uint32(len(p.key)) != a.KeyLen || uint32(len(p.salt)) != a.SaltLen
+}
+
+type argon2idHash struct {
+	version int
+	time    uint32
+	memory  uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func parseArgon2id(encoded string) (argon2idHash, error) {
+	var res argon2idHash
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return res, ErrUnknownHash
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(parts[2], "v="))
+	if err != nil {
+		return res, err
+	}
+	res.version = version
+	params := phcParams(parts[3])
+	m, err := strconv.ParseUint(params["m"], 10, 32)
+	if err != nil {
+		return res, err
+	}
+	t, err := strconv.ParseUint(params["t"], 10, 32)
+	if err != nil {
+		return res, err
+	}
+	p, err := strconv.ParseUint(params["p"], 10, 8)
+	if err != nil {
+		return res, err
+	}
+	if m == 0 || t == 0 || p == 0 { // argon2 panics on these, and a stored hash shouldn't be able to take the server down
+		return res, ErrUnknownHash
+	}
+	res.memory, res.time, res.threads = uint32(m), uint32(t), uint8(p)
+	res.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return res, err
+	}
+	res.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return res, err
+	}
+	if len(res.salt) == 0 || len(res.key) == 0 { // an empty key would match any password
+		return res, ErrUnknownHash
+	}
+	return res, nil
+}
@@ -0,0 +1,70 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+var ErrUnknownHash = errors.New("stored password hash has unknown format")
+
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	// Owns tells whether the encoded hash was made by this algorithm
+	Owns(encoded string) bool
+	// Outdated tells whether an owned hash was made with other parameters than the current ones
+	Outdated(encoded string) bool
+}
+
+// Hashers makes new hashes with Current, but still accepts everything that any of Legacy can verify
+type Hashers struct {
+	Current Hasher
+	Legacy  []Hasher
+
+	dummyOnce sync.Once
+	dummy     string // a hash of nothing with Current, checked instead of users that don't exist
+}
+
+func (h *Hashers) Hash(password string) (string, error) {
+	return h.Current.Hash(password)
+}
+
+// Check verifies the password; rehash means the caller should store a fresh hash from Hash
+func (h *Hashers) Check(password, encoded string) (ok bool, rehash bool, err error) {
+	if h.Current.Owns(encoded) {
+		ok, err = h.Current.Verify(password, encoded)
+		return ok, ok && h.Current.Outdated(encoded), err
+	}
+	for _, legacy := range h.Legacy {
+		if legacy.Owns(encoded) {
+			ok, err = legacy.Verify(password, encoded)
+			return ok, ok, err
+		}
+	}
+	if encoded == "" { // no such user, but it should take as long as a wrong password, or the timing tells which emails are registered
+		h.dummyOnce.Do(func() {
+			h.dummy, _ = h.Current.Hash("")
+		})
+		_, _ = h.Current.Verify(password, h.dummy)
+		return false, false, nil
+	}
+	return false, false, ErrUnknownHash
+}
+
+// TrimLegacyQuotes old bcrypt hashes were stored as 'hash'; PHC strings are stored as they are
+func TrimLegacyQuotes(stored string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(stored, "'"), "'")
+}
+
+// phcParams parses "m=65536,t=3,p=2" into a map
+func phcParams(s string) map[string]string {
+	res := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 {
+			res[parts[0]] = parts[1]
+		}
+	}
+	return res
+}
@@ -0,0 +1,115 @@
+package password
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2id the cheapest parameters there are, tests don't need real hashes
+func testArgon2id() *Argon2id {
+	return NewArgon2id(1, 8, 1)
+}
+
+func TestParseArgon2id(t *testing.T) {
+	valid, err := testArgon2id().Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const salt, key = "c2FsdHNhbHRzYWx0c2FsdA", "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr bool
+	}{
+		{"valid", valid, false},
+		{"valid by hand", "$argon2id$v=19$m=8,t=1,p=1$" + salt + "$" + key, false},
+		{"empty", "", true},
+		{"too few parts", "$argon2id$v=19$m=8,t=1,p=1$" + salt, true},
+		{"other algorithm", "$argon2i$v=19$m=8,t=1,p=1$" + salt + "$" + key, true},
+		{"bad version", "$argon2id$v=x$m=8,t=1,p=1$" + salt + "$" + key, true},
+		{"missing parameter", "$argon2id$v=19$m=8,t=1$" + salt + "$" + key, true},
+		{"threads overflow", "$argon2id$v=19$m=8,t=1,p=256$" + salt + "$" + key, true},
+		{"bad salt", "$argon2id$v=19$m=8,t=1,p=1$not base64!$" + key, true},
+		{"bad key", "$argon2id$v=19$m=8,t=1,p=1$" + salt + "$not base64!", true},
+		{"zero memory", "$argon2id$v=19$m=0,t=1,p=1$" + salt + "$" + key, true},
+		{"zero time", "$argon2id$v=19$m=8,t=0,p=1$" + salt + "$" + key, true},
+		{"zero threads", "$argon2id$v=19$m=8,t=1,p=0$" + salt + "$" + key, true},
+		{"empty salt", "$argon2id$v=19$m=8,t=1,p=1$$" + key, true},
+		{"empty key", "$argon2id$v=19$m=8,t=1,p=1$" + salt + "$", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseArgon2id(tt.encoded)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseArgon2id(%q) error = %v, wantErr %v", tt.encoded, err, tt.wantErr)
+			}
+			if tt.wantErr { // nothing that doesn't parse gets as far as argon2 itself
+				ok, err := testArgon2id().Verify("secret", tt.encoded)
+				if ok || err == nil {
+					t.Errorf("Verify(%q) = %v, %v, want an error", tt.encoded, ok, err)
+				}
+			}
+		})
+	}
+}
+
+func TestHashersCheck(t *testing.T) {
+	current := testArgon2id()
+	h := &Hashers{Current: current, Legacy: []Hasher{&Bcrypt{Cost: bcrypt.MinCost}}}
+	fresh, err := current.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outdated, err := NewArgon2id(2, 8, 1).Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		password   string
+		encoded    string
+		wantOk     bool
+		wantRehash bool
+		wantErr    error
+	}{
+		{"current", "secret", fresh, true, false, nil},
+		{"current, wrong password", "wrong", fresh, false, false, nil},
+		{"outdated parameters", "secret", outdated, true, true, nil},
+		{"outdated parameters, wrong password", "wrong", outdated, false, false, nil},
+		{"legacy bcrypt", "secret", string(legacy), true, true, nil},
+		{"legacy bcrypt, wrong password", "wrong", string(legacy), false, false, nil},
+		{"legacy bcrypt stored in quotes", "secret", TrimLegacyQuotes("'" + string(legacy) + "'"), true, true, nil},
+		{"no such user", "secret", "", false, false, nil},
+		{"unknown format", "secret", "plain text", false, false, ErrUnknownHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := h.Check(tt.password, tt.encoded)
+			if ok != tt.wantOk || rehash != tt.wantRehash || !errors.Is(err, tt.wantErr) {
+				t.Errorf("Check() = %v, %v, %v, want %v, %v, %v", ok, rehash, err, tt.wantOk, tt.wantRehash, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTrimLegacyQuotes(t *testing.T) {
+	tests := []struct {
+		stored, want string
+	}{
+		{"'$2a$10$abc'", "$2a$10$abc"},
+		{"$2a$10$abc", "$2a$10$abc"},
+		{"$argon2id$v=19$m=8,t=1,p=1$c2FsdA$a2V5", "$argon2id$v=19$m=8,t=1,p=1$c2FsdA$a2V5"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := TrimLegacyQuotes(tt.stored); got != tt.want {
+			t.Errorf("TrimLegacyQuotes(%q) = %q, want %q", tt.stored, got, tt.want)
+		}
+	}
+}
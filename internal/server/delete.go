@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func (s *Server) setupDeleteRouting() {
+	// only whoever added the brand and admins; it can be restored until the retention job purges it
+	s.conn.Delete("/api/brands/:id", s.requireSession, func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		err = s.authorizeBrandOwner(c.UserContext(), currentSession(c).Email, id)
+		if err != nil {
+			return s.sendBrandAccessError(c, err)
+		}
+		err = s.brands.DeleteBrand(c.UserContext(), id, currentSession(c).Email)
+		if err != nil {
+			return s.sendLookupError(c, err)
+		}
+		return c.SendStatus(http.StatusNoContent)
+	})
+	s.conn.Post("/api/brands/:id/restore", s.requireSession, func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		err = s.authorizeBrandOwner(c.UserContext(), currentSession(c).Email, id)
+		if err != nil {
+			return s.sendBrandAccessError(c, err)
+		}
+		err = s.brands.RestoreBrand(c.UserContext(), id, currentSession(c).Email)
+		if err != nil {
+			return s.sendLookupError(c, err)
+		}
+		return s.sendBrandVersion(c, id)
+	})
+}
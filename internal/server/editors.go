@@ -0,0 +1,171 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"accelerator/internal/db"
+	"accelerator/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// sendBrandAccessError answers for the errors of authorizeBrandEdit, authorizeBrandOwner and authorizeReview
+func (s *Server) sendBrandAccessError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, db.ERRNOPERM):
+		s.log.Errorln(err)
+		return c.SendStatus(http.StatusForbidden)
+	case errors.Is(err, sql.ErrNoRows):
+		return c.SendStatus(http.StatusNotFound)
+	default:
+		return s.sendError(c, err)
+	}
+}
+
+func (s *Server) setupEditorsRouting() {
+	s.conn.Post("/api/users/brands/editors/invite", s.requireSession, func(c *fiber.Ctx) error {
+		var req models.EditorChange
+		err := json.Unmarshal(c.Body(), &req)
+		if err != nil {
+			s.log.Errorln(err)
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		email := currentSession(c).Email
+		err = s.authorizeBrandOwner(c.UserContext(), email, req.BrandId)
+		if err != nil {
+			return s.sendBrandAccessError(c, err)
+		}
+		uid, err := s.users.GetIdByEmail(c.UserContext(), email)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		err = s.brands.InviteEditor(c.UserContext(), req.BrandId, req.Email, uid)
+		if errors.Is(err, db.ERRNOUSER) {
+			return c.SendStatus(http.StatusNotFound)
+		}
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		return c.SendStatus(http.StatusOK)
+	})
+	s.conn.Get("/api/users/brands/editors/invites", s.requireSession, func(c *fiber.Ctx) error {
+		uid, err := s.users.GetIdByEmail(c.UserContext(), currentSession(c).Email)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		ids, err := s.brands.GetPendingInvites(c.UserContext(), uid)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		marshal, err := json.Marshal(ids)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		return c.Send(marshal)
+	})
+	s.conn.Post("/api/users/brands/editors/accept", s.requireSession, func(c *fiber.Ctx) error {
+		var req models.EditorChange
+		err := json.Unmarshal(c.Body(), &req)
+		if err != nil {
+			s.log.Errorln(err)
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		uid, err := s.users.GetIdByEmail(c.UserContext(), currentSession(c).Email)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		err = s.brands.AcceptInvite(c.UserContext(), req.BrandId, uid)
+		if errors.Is(err, db.ERRNOTEDITOR) {
+			return c.SendStatus(http.StatusNotFound)
+		}
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		return c.SendStatus(http.StatusOK)
+	})
+	s.conn.Get("/api/users/brands/editors", s.requireSession, func(c *fiber.Ctx) error {
+		brandId, err := strconv.Atoi(c.Query("brand_id"))
+		if err != nil {
+			s.log.Errorln(err)
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		err = s.authorizeBrandEdit(c.UserContext(), currentSession(c).Email, brandId)
+		if err != nil {
+			return s.sendBrandAccessError(c, err)
+		}
+		editors, err := s.brands.GetBrandEditors(c.UserContext(), brandId)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		marshal, err := json.Marshal(editors)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		return c.Send(marshal)
+	})
+	s.conn.Post("/api/users/brands/editors/remove", s.requireSession, func(c *fiber.Ctx) error {
+		var req models.EditorChange
+		err := json.Unmarshal(c.Body(), &req)
+		if err != nil {
+			s.log.Errorln(err)
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		email := currentSession(c).Email
+		if req.Email != email { // anyone can leave a brand, only the owner can remove others
+			err = s.authorizeBrandOwner(c.UserContext(), email, req.BrandId)
+			if err != nil {
+				return s.sendBrandAccessError(c, err)
+			}
+		}
+		uid, err := s.users.GetIdByEmail(c.UserContext(), req.Email)
+		if errors.Is(err, db.ERRNOUSER) {
+			return c.SendStatus(http.StatusNotFound)
+		}
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		err = s.brands.RemoveEditor(c.UserContext(), req.BrandId, uid)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		return c.SendStatus(http.StatusOK)
+	})
+	s.conn.Post("/api/users/brands/transfer", s.requireSession, func(c *fiber.Ctx) error {
+		var req models.EditorChange
+		err := json.Unmarshal(c.Body(), &req)
+		if err != nil {
+			s.log.Errorln(err)
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		from, err := s.users.GetIdByEmail(c.UserContext(), currentSession(c).Email)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		// only the primary owner can give the brand away, admins are not an exception here
+		creator, err := s.brands.GetBrandCreator(c.UserContext(), req.BrandId)
+		if err != nil {
+			return s.sendBrandAccessError(c, err)
+		}
+		if creator != from {
+			return c.SendStatus(http.StatusForbidden)
+		}
+		to, err := s.users.GetIdByEmail(c.UserContext(), req.Email)
+		if errors.Is(err, db.ERRNOUSER) {
+			return c.SendStatus(http.StatusNotFound)
+		}
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		err = s.brands.TransferBrand(c.UserContext(), req.BrandId, from, to)
+		if errors.Is(err, db.ERRNOTEDITOR) { // has to accept an invite first
+			return c.SendStatus(http.StatusConflict)
+		}
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		return c.SendStatus(http.StatusOK)
+	})
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"accelerator/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+func brandETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// listETag is weak and made of the ids and versions of the brands, every change of a brand bumps its version.
+// extra is whatever else is in the response besides the brands, like the next cursor or the total
+func listETag(brands []models.Brand, extra ...string) string {
+	h := fnv.New64a()
+	for _, b := range brands {
+		_, _ = h.Write([]byte(strconv.Itoa(b.Id) + ":" + strconv.Itoa(b.Version) + ","))
+	}
+	for _, e := range extra {
+		_, _ = h.Write([]byte("|" + e))
+	}
+	return `W/"` + strconv.FormatUint(h.Sum64(), 16) + `"`
+}
+
+// ifMatchVersion gives the version the client edited, 0 means it doesn't care (no header or "*").
+// ok is false when the header can't match any version, which is a 412 right away. If-Match compares strongly, so weak tags never match
+func ifMatchVersion(c *fiber.Ctx) (version int, ok bool) {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if header == "" || header == "*" {
+		return 0, true
+	}
+	if strings.Contains(header, ",") || !strings.HasPrefix(header, `"`) || !strings.HasSuffix(header, `"`) {
+		return 0, false
+	}
+	version, err := strconv.Atoi(strings.Trim(header, `"`))
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// noneMatch tells whether If-None-Match has the etag, so the client already has this version. Comparison is weak
+func noneMatch(c *fiber.Ctx, etag string) bool {
+	header := c.Get(fiber.HeaderIfNoneMatch)
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"accelerator/internal/db"
+	"accelerator/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// authorizeBrandHistory moderators can look at any brand's history, everyone else only at the ones they can edit
+func (s *Server) authorizeBrandHistory(ctx context.Context, email string, brandId int) error {
+	role, err := s.users.GetRoleByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if role >= models.MODERATOR {
+		return nil
+	}
+	return s.authorizeBrandEdit(ctx, email, brandId)
+}
+
+// revisionParam reads a version from the route or the query, ok is false if it isn't a positive number
+func revisionParam(s string) (int, bool) {
+	v, err := strconv.Atoi(s)
+	return v, err == nil && v > 0
+}
+
+func (s *Server) setupHistoryRouting() {
+	s.conn.Get("/api/brands/:id/revisions", s.requireSession, func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		err = s.authorizeBrandHistory(c.UserContext(), currentSession(c).Email, id)
+		if err != nil {
+			return s.sendBrandAccessError(c, err)
+		}
+		res, err := s.brands.GetRevisions(c.UserContext(), id)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		marshal, err := json.Marshal(&res)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		return c.Send(marshal)
+	})
+	// has to go before /:version, or "diff" would be taken for a version
+	s.conn.Get("/api/brands/:id/revisions/diff", s.requireSession, func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		from, okFrom := revisionParam(c.Query("from"))
+		to, okTo := revisionParam(c.Query("to"))
+		if !okFrom || !okTo {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		err = s.authorizeBrandHistory(c.UserContext(), currentSession(c).Email, id)
+		if err != nil {
+			return s.sendBrandAccessError(c, err)
+		}
+		a, err := s.brands.GetRevision(c.UserContext(), id, from)
+		if err != nil {
+			return s.sendLookupError(c, err)
+		}
+		b, err := s.brands.GetRevision(c.UserContext(), id, to)
+		if err != nil {
+			return s.sendLookupError(c, err)
+		}
+		res, err := models.DiffBrands(a.Brand, b.Brand)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		marshal, err := json.Marshal(&res)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		return c.Send(marshal)
+	})
+	s.conn.Get("/api/brands/:id/revisions/:version", s.requireSession, func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		version, ok := revisionParam(c.Params("version"))
+		if err != nil || !ok {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		err = s.authorizeBrandHistory(c.UserContext(), currentSession(c).Email, id)
+		if err != nil {
+			return s.sendBrandAccessError(c, err)
+		}
+		res, err := s.brands.GetRevision(c.UserContext(), id, version)
+		if err != nil {
+			return s.sendLookupError(c, err)
+		}
+		marshal, err := json.Marshal(&res)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		return c.Send(marshal)
+	})
+	// restoring is just another edit, so it gets its own revision and nothing in between is lost.
+	// Images aren't in revisions: products that still exist keep theirs, deleted ones come back without
+	s.conn.Post("/api/brands/:id/revisions/:version/restore", s.requireSession, func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		version, ok := revisionParam(c.Params("version"))
+		if err != nil || !ok {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		err = s.authorizeBrandEdit(c.UserContext(), currentSession(c).Email, id)
+		if err != nil {
+			return s.sendBrandAccessError(c, err)
+		}
+		current, ok := ifMatchVersion(c)
+		if !ok {
+			return c.SendStatus(http.StatusPreconditionFailed)
+		}
+		rev, err := s.brands.GetRevision(c.UserContext(), id, version)
+		if err != nil {
+			return s.sendLookupError(c, err)
+		}
+		restored := rev.Brand // status stays whatever UpdateBrand makes of it, going back in history doesn't publish anything
+		restored.Id = id
+		restored.Version = current
+		keepStatus, err := s.editKeepsStatus(c.UserContext(), currentSession(c).Email, id)
+		if err != nil {
+			return s.sendLookupError(c, err)
+		}
+		err = s.brands.UpdateBrand(c.UserContext(), restored, currentSession(c).Email, keepStatus)
+		if errors.Is(err, db.ERRSTALE) {
+			return c.SendStatus(http.StatusPreconditionFailed)
+		}
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		c.Set(fiber.HeaderETag, brandETag(restored.Version))
+		return c.SendStatus(http.StatusOK)
+	})
+}
+
+// sendLookupError 404 for things that aren't there, 500 for everything else
+func (s *Server) sendLookupError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.SendStatus(http.StatusNotFound)
+	}
+	return s.sendError(c, err)
+}
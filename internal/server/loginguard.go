@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"accelerator/internal/session"
+	"accelerator/internal/sessioncash"
+)
+
+// loginGuard counts failed logins in the session cash and locks keys that fail too often.
+// Every failure after the threshold doubles the lock, up to maxLockout
+type loginGuard struct {
+	cash       sessioncash.CashDb
+	window     time.Duration
+	lockout    time.Duration
+	maxLockout time.Duration
+}
+
+func emailAttemptsKey(email string) string {
+	return "email:" + email
+}
+
+func ipAttemptsKey(ip string) string {
+	return "ip:" + ip
+}
+
+// retryAfter tells how long the key is still locked for, zero means it isn't
+func (g *loginGuard) retryAfter(ctx context.Context, key string) (time.Duration, error) {
+	a, err := g.cash.FindAttempts(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if !a.IsLocked() {
+		return 0, nil
+	}
+	return time.Until(a.LockedUntil), nil
+}
+
+// fail the cash counts the failure and decides on the lock in one step, parallel failures can't overwrite each other's count
+func (g *loginGuard) fail(ctx context.Context, key string, maxAttempts int) error {
+	if maxAttempts <= 0 {
+		return nil
+	}
+	_, err := g.cash.FailAttempt(ctx, key, session.LockPolicy{MaxAttempts: maxAttempts, Lockout: g.lockout, MaxLockout: g.maxLockout, Window: g.window})
+	return err
+}
+
+func (g *loginGuard) reset(ctx context.Context, key string) error {
+	return g.cash.DeleteAttempts(ctx, key)
+}
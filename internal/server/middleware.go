@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+
+	"accelerator/internal/session"
+	"github.com/gofiber/fiber/v2"
+)
+
+const sessionLocalsKey = "session"
+
+// requireSession checks the token from the Authorization header and puts the session into c.Locals.
+// A missing or expired token is 401, so handlers behind it can keep 403 for missing permissions; trouble with the cash is 5xx
+func (s *Server) requireSession(c *fiber.Ctx) error {
+	token := c.Get(fiber.HeaderAuthorization)
+	if token == "" {
+		return c.SendStatus(http.StatusUnauthorized)
+	}
+	ses, status, err := s.isSessionActive(c.UserContext(), token)
+	if err != nil { // the cash is down or slow, that says nothing about the token, so nobody gets logged out over it
+		return s.sendError(c, err)
+	}
+	if status == EXPIRED { // unknown tokens come as empty sessions, which are expired too
+		if ses.Token != "" {
+			err = s.scash.DeleteSession(c.UserContext(), ses.Token)
+			if err != nil {
+				s.log.Errorln(err)
+			}
+		}
+		return c.SendStatus(http.StatusUnauthorized)
+	}
+	err = s.slideSession(c.UserContext(), &ses)
+	if err != nil { // the session is still valid for now, no reason to fail the request
+		s.log.Errorln(err)
+	}
+	c.Locals(sessionLocalsKey, ses)
+	return c.Next()
+}
+
+// currentSession is only meaningful in handlers that are behind requireSession
+func currentSession(c *fiber.Ctx) session.Session {
+	ses, _ := c.Locals(sessionLocalsKey).(session.Session)
+	return ses
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"accelerator/internal/db"
+	"accelerator/internal/mailer"
+	"accelerator/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// sendStatusError answers for the errors of ChangeBrandStatus
+func (s *Server) sendStatusError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, db.ERRBADSTATUS) {
+		return c.SendStatus(http.StatusConflict)
+	}
+	return s.sendLookupError(c, err)
+}
+
+// sendBrandVersion 200 with the brand's current ETag
+func (s *Server) sendBrandVersion(c *fiber.Ctx, id int) error {
+	version, _, err := s.brands.GetBrandVersion(c.UserContext(), id)
+	if err != nil {
+		return s.sendError(c, err)
+	}
+	c.Set(fiber.HeaderETag, brandETag(version))
+	return c.SendStatus(http.StatusOK)
+}
+
+// notifySubmitter tells whoever added the brand how the review went. The decision is already made, so failures are only logged
+func (s *Server) notifySubmitter(ctx context.Context, brandId int, subject, body string) {
+	email, err := s.brands.GetBrandCreatorEmail(ctx, brandId)
+	if err != nil {
+		s.log.Errorln(err)
+		return
+	}
+	if email == "" {
+		return
+	}
+	err = s.mail.Send(mailer.Message{To: email, Subject: subject, Body: body})
+	if err != nil {
+		s.log.Errorln(err)
+	}
+}
+
+func (s *Server) setupModerationRouting() {
+	// submit a draft, or a rejected brand that was fixed without editing, for review
+	s.conn.Post("/api/brands/:id/submit", s.requireSession, func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		err = s.authorizeBrandEdit(c.UserContext(), currentSession(c).Email, id)
+		if err != nil {
+			return s.sendBrandAccessError(c, err)
+		}
+		err = s.brands.ChangeBrandStatus(c.UserContext(), id, currentSession(c).Email, models.PENDING, "", models.DRAFT, models.REJECTED)
+		if err != nil {
+			return s.sendStatusError(c, err)
+		}
+		return s.sendBrandVersion(c, id)
+	})
+	s.conn.Post("/api/brands/:id/archive", s.requireSession, func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		err = s.authorizeBrandOwner(c.UserContext(), currentSession(c).Email, id)
+		if err != nil {
+			return s.sendBrandAccessError(c, err)
+		}
+		err = s.brands.ChangeBrandStatus(c.UserContext(), id, currentSession(c).Email, models.ARCHIVED, "", models.DRAFT, models.PENDING, models.PUBLISHED, models.REJECTED)
+		if err != nil {
+			return s.sendStatusError(c, err)
+		}
+		return s.sendBrandVersion(c, id)
+	})
+	s.conn.Get("/api/moderation/brands/queue", s.requireSession, s.requireRole(models.MODERATOR), func(c *fiber.Ctx) error {
+		after, err := decodeCursor(c.Query("cursor"))
+		if err != nil {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		limit := pageLimit(c.Query("limit"))
+		brands, more, err := s.brands.GetModerationQueue(c.UserContext(), after.Offset, limit)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		page := models.BrandPage{Items: brands}
+		if more {
+			page.NextCursor = cursor{Offset: after.Offset + len(brands)}.encode()
+		}
+		marshal, err := json.Marshal(page)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		return c.Send(marshal)
+	})
+	s.conn.Post("/api/moderation/brands/:id/approve", s.requireSession, s.requireRole(models.MODERATOR), func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		err = s.authorizeReview(c.UserContext(), currentSession(c).Email, id)
+		if err != nil {
+			return s.sendBrandAccessError(c, err)
+		}
+		err = s.brands.ChangeBrandStatus(c.UserContext(), id, currentSession(c).Email, models.PUBLISHED, "", models.PENDING)
+		if err != nil {
+			return s.sendStatusError(c, err)
+		}
+		s.notifySubmitter(c.UserContext(), id, "Your brand is published", "Your brand passed the review and is visible to everyone now: "+s.publicUrl+"/brands/"+strconv.Itoa(id))
+		return s.sendBrandVersion(c, id)
+	})
+	s.conn.Post("/api/moderation/brands/:id/reject", s.requireSession, s.requireRole(models.MODERATOR), func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		var req models.ModerationDecision
+		err = json.Unmarshal(c.Body(), &req)
+		req.Reason = strings.TrimSpace(req.Reason)
+		if err != nil || req.Reason == "" { // the submitter has to know what to fix
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		err = s.authorizeReview(c.UserContext(), currentSession(c).Email, id)
+		if err != nil {
+			return s.sendBrandAccessError(c, err)
+		}
+		err = s.brands.ChangeBrandStatus(c.UserContext(), id, currentSession(c).Email, models.REJECTED, req.Reason, models.PENDING)
+		if err != nil {
+			return s.sendStatusError(c, err)
+		}
+		s.notifySubmitter(c.UserContext(), id, "Your brand was not approved", "A moderator didn't approve your brand: "+req.Reason+"\nFix it and it will be reviewed again: "+s.publicUrl+"/brands/"+strconv.Itoa(id))
+		return s.sendBrandVersion(c, id)
+	})
+}
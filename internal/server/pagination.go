@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"accelerator/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultPageLimit    = 30
+	maxPageLimit        = 100
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 20
+)
+
+// cursor is what clients get as next_cursor. They shouldn't rely on what's inside, so it goes out as base64
+type cursor struct {
+	Id     int    `json:"id,omitempty"`
+	Key    string `json:"key,omitempty"`
+	Sort   string `json:"sort,omitempty"`   // a cursor only makes sense for the order it was made in
+	Offset int    `json:"offset,omitempty"` // for ranked results, where there is no stable key to continue after
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+var errBadCursor = errors.New("cursor points before the first page")
+
+// decodeCursor an empty string is the first page. Cursors come from clients, so anything negative in them is an error
+func decodeCursor(s string) (cursor, error) {
+	var res cursor
+	if s == "" {
+		return res, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return res, err
+	}
+	err = json.Unmarshal(data, &res)
+	if err != nil {
+		return res, err
+	}
+	if res.Id < 0 || res.Offset < 0 {
+		return cursor{}, errBadCursor
+	}
+	return res, nil
+}
+
+// pageLimit falls back to the default for anything that isn't a positive number, and never goes over the maximum
+func pageLimit(s string) int {
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit <= 0 {
+		return defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		return maxPageLimit
+	}
+	return limit
+}
+
+// parseBrandFilter reads ?city=&price_min=&price_max=&currency=&contacts=phone,telegram&has_stats=&sort=
+func parseBrandFilter(c *fiber.Ctx) (models.BrandFilter, error) {
+	f := models.BrandFilter{City: c.Query("city"), Currency: c.Query("currency"), Sort: c.Query("sort")}
+	var err error
+	f.PriceMin, err = optionalInt(c.Query("price_min"))
+	if err != nil {
+		return f, err
+	}
+	f.PriceMax, err = optionalInt(c.Query("price_max"))
+	if err != nil {
+		return f, err
+	}
+	if v := c.Query("contacts"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			// stored the same way as when brands are added, unknown types end up as "other"
+			f.Contacts = append(f.Contacts, models.NewContactType(strings.TrimSpace(t)).String())
+		}
+	}
+	if v := c.Query("has_stats"); v != "" {
+		has, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, err
+		}
+		f.HasStats = &has
+	}
+	return f, nil
+}
+
+func optionalInt(s string) (*int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
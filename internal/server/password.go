@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"accelerator/internal/db"
+	"accelerator/internal/mailer"
+	"accelerator/internal/session"
+	"accelerator/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+func forgotAttemptsKey(ip string) string {
+	return "forgot:" + ip
+}
+
+func (s *Server) setupPasswordRouting() {
+	// always 200 once past the limit, so that nobody can find out which emails are registered. Every request sends an email,
+	// so an ip gets as many of them as it gets failed logins
+	s.conn.Post("/api/users/password/forgot", func(c *fiber.Ctx) error {
+		var req models.PasswordForgot
+		err := json.Unmarshal(c.Body(), &req)
+		if err != nil {
+			s.log.Errorln(err)
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		key := forgotAttemptsKey(c.IP())
+		wait, err := s.guard.retryAfter(c.UserContext(), key)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		if wait > 0 {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return c.SendStatus(http.StatusTooManyRequests)
+		}
+		err = s.guard.fail(c.UserContext(), key, s.loginMaxIpAttempts)
+		if err != nil {
+			s.log.Errorln(err)
+		}
+		_, err = s.users.GetIdByEmail(c.UserContext(), req.Email)
+		if errors.Is(err, db.ERRNOUSER) {
+			return c.SendStatus(http.StatusOK)
+		}
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		token := session.NewResetToken(cashTime(time.Now().Add(s.resetLen)), req.Email)
+		err = s.scash.StoreResetToken(c.UserContext(), &token)
+		if err != nil { // failing only for registered emails would give them away
+			s.log.Errorln(err)
+			return c.SendStatus(http.StatusOK)
+		}
+		link := s.publicUrl + "/reset?token=" + url.QueryEscape(token.Token)
+		err = s.mail.Send(mailer.Message{
+			To:      req.Email,
+			Subject: "Password reset",
+			Body:    "Someone asked to reset your password. If it was you, follow the link: " + link + "\nThe link works once and expires in " + s.resetLen.String() + ".",
+		})
+		if err != nil {
+			s.log.Errorln(err)
+		}
+		return c.SendStatus(http.StatusOK)
+	})
+	s.conn.Post("/api/users/password/reset", func(c *fiber.Ctx) error {
+		var req models.PasswordReset
+		err := json.Unmarshal(c.Body(), &req)
+		if err != nil || req.Password == "" {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		token, err := s.scash.TakeResetToken(c.UserContext(), req.Token)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		if token.Email == "" || token.IsExpired() {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		err = s.users.SetPassword(c.UserContext(), token.Email, req.Password)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		// whoever knew the old password shouldn't stay logged in
+		err = s.scash.DeleteSessionsByEmail(c.UserContext(), token.Email)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		err = s.guard.reset(c.UserContext(), emailAttemptsKey(token.Email))
+		if err != nil {
+			s.log.Errorln(err)
+		}
+		return c.SendStatus(http.StatusOK)
+	})
+}
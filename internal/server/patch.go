@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"accelerator/internal/db"
+	"accelerator/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+const mergePatchType = "application/merge-patch+json"
+
+// mergePatch applies an RFC 7396 merge patch: objects are merged key by key, null removes a key,
+// everything else (arrays too) replaces what was there
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+// patchBrand gives the stored brand with the patch applied. Products come without images unless the patch sets them,
+// and those without images keep theirs on update
+func patchBrand(stored *models.Brand, patch []byte) (models.Brand, error) {
+	var res models.Brand
+	var doc, p interface{}
+	raw, err := json.Marshal(stored)
+	if err != nil {
+		return res, err
+	}
+	err = json.Unmarshal(raw, &doc)
+	if err != nil {
+		return res, err
+	}
+	err = json.Unmarshal(patch, &p)
+	if err != nil {
+		return res, err
+	}
+	raw, err = json.Marshal(mergePatch(doc, p))
+	if err != nil {
+		return res, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields() // a typo in a field name shouldn't silently do nothing
+	err = dec.Decode(&res)
+	return res, err
+}
+
+func (s *Server) setupPatchRouting() {
+	// only merge patches for now, JSON Patch (RFC 6902) gets 415
+	s.conn.Patch("/api/brands/:id", s.requireSession, func(c *fiber.Ctx) error {
+		ctype, _, err := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+		if err != nil || (ctype != mergePatchType && ctype != fiber.MIMEApplicationJSON) {
+			return c.SendStatus(http.StatusUnsupportedMediaType)
+		}
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		err = s.authorizeBrandEdit(c.UserContext(), currentSession(c).Email, id)
+		if err != nil {
+			return s.sendBrandAccessError(c, err)
+		}
+		stored, err := s.brands.GetBrandForEdit(c.UserContext(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.SendStatus(http.StatusNotFound)
+		}
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		version, ok := ifMatchVersion(c)
+		if !ok || (version != 0 && version != stored.Version) {
+			return c.SendStatus(http.StatusPreconditionFailed)
+		}
+		patched, err := patchBrand(&stored, c.Body())
+		if err != nil {
+			return c.Status(http.StatusBadRequest).SendString(err.Error())
+		}
+		// moderators decide on these, not the patch
+		patched.Id = stored.Id
+		patched.Status = stored.Status
+		patched.Reason = stored.Reason
+		patched.Version = stored.Version // the patch was applied to this one, so it must not have changed in between
+		err = patched.Validate()
+		if err != nil {
+			return c.Status(http.StatusUnprocessableEntity).SendString(err.Error())
+		}
+		changes, err := models.DiffBrands(&stored, &patched)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		if len(changes) == 0 { // nothing to save, so no new version either
+			c.Set(fiber.HeaderETag, brandETag(stored.Version))
+			return c.SendStatus(http.StatusOK)
+		}
+		keepStatus, err := s.editKeepsStatus(c.UserContext(), currentSession(c).Email, patched.Id)
+		if err != nil {
+			return s.sendLookupError(c, err)
+		}
+		err = s.brands.UpdateBrand(c.UserContext(), &patched, currentSession(c).Email, keepStatus)
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.SendStatus(http.StatusNotFound)
+		}
+		if errors.Is(err, db.ERRSTALE) {
+			return c.SendStatus(http.StatusPreconditionFailed)
+		}
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		c.Set(fiber.HeaderETag, brandETag(patched.Version))
+		return c.SendStatus(http.StatusOK)
+	})
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"accelerator/internal/db"
+	"accelerator/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// requireRole lets through users with at least the given role. It has to go after requireSession
+func (s *Server) requireRole(min models.Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, err := s.users.GetRoleByEmail(c.UserContext(), currentSession(c).Email)
+		if errors.Is(err, db.ERRNOUSER) { // session outlived the account
+			return c.SendStatus(http.StatusUnauthorized)
+		}
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		if role < min {
+			return c.SendStatus(http.StatusForbidden)
+		}
+		return c.Next()
+	}
+}
+
+// PromoteAdmins gives the admin role to the accounts from the admins config, otherwise nobody could hand out roles.
+// Accounts that aren't there or verified yet get it when they verify the email
+func (s *Server) PromoteAdmins(ctx context.Context) error {
+	for email := range s.admins {
+		err := s.promoteAdmin(ctx, email)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// promoteAdmin does nothing for emails that aren't in the admins config, or aren't registered and verified.
+// Unverified accounts are skipped so that nobody can become an admin by registering someone else's email first
+func (s *Server) promoteAdmin(ctx context.Context, email string) error {
+	if !s.admins[email] {
+		return nil
+	}
+	verified, err := s.users.IsVerified(ctx, email)
+	if errors.Is(err, db.ERRNOUSER) {
+		return nil
+	}
+	if err != nil || !verified {
+		return err
+	}
+	return s.users.SetRole(ctx, email, models.ADMIN)
+}
+
+// authorizeBrandEdit admins can edit any brand, everyone else only the ones they added or were invited to. Gives db.ERRNOPERM if not allowed
+func (s *Server) authorizeBrandEdit(ctx context.Context, email string, brandId int) error {
+	err := s.authorizeBrandOwner(ctx, email, brandId)
+	if !errors.Is(err, db.ERRNOPERM) {
+		return err
+	}
+	uid, err := s.users.GetIdByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	isEditor, err := s.brands.IsBrandEditor(ctx, brandId, uid)
+	if err != nil {
+		return err
+	}
+	if !isEditor {
+		return db.ERRNOPERM
+	}
+	return nil
+}
+
+// canSeeUnpublished brands that aren't published are only for moderators and whoever can edit them. The route is public,
+// so the session is optional here: no token or a bad one is just an anonymous caller
+func (s *Server) canSeeUnpublished(c *fiber.Ctx, brandId int) (bool, error) {
+	token := c.Get(fiber.HeaderAuthorization)
+	if token == "" {
+		return false, nil
+	}
+	ses, status, err := s.isSessionActive(c.UserContext(), token)
+	if err != nil {
+		return false, err
+	}
+	if status != GOOD {
+		return false, nil
+	}
+	role, err := s.users.GetRoleByEmail(c.UserContext(), ses.Email)
+	if errors.Is(err, db.ERRNOUSER) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if role >= models.MODERATOR {
+		return true, nil
+	}
+	err = s.authorizeBrandEdit(c.UserContext(), ses.Email, brandId)
+	if errors.Is(err, db.ERRNOPERM) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// authorizeReview moderators don't review their own brands: neither the ones they added nor the ones they edit. Gives db.ERRNOPERM for those
+func (s *Server) authorizeReview(ctx context.Context, email string, brandId int) error {
+	uid, err := s.users.GetIdByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	creator, err := s.brands.GetBrandCreator(ctx, brandId)
+	if err != nil {
+		return err
+	}
+	if uid == creator {
+		return db.ERRNOPERM
+	}
+	isEditor, err := s.brands.IsBrandEditor(ctx, brandId, uid)
+	if err != nil {
+		return err
+	}
+	if isEditor {
+		return db.ERRNOPERM
+	}
+	return nil
+}
+
+// editKeepsStatus an edit only skips review if it comes from a moderator who could review the brand, i.e. not their own one
+func (s *Server) editKeepsStatus(ctx context.Context, email string, brandId int) (bool, error) {
+	role, err := s.users.GetRoleByEmail(ctx, email)
+	if err != nil || role < models.MODERATOR {
+		return false, err
+	}
+	err = s.authorizeReview(ctx, email, brandId)
+	if errors.Is(err, db.ERRNOPERM) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// authorizeBrandOwner only admins and whoever added the brand can decide who else edits it
+func (s *Server) authorizeBrandOwner(ctx context.Context, email string, brandId int) error {
+	role, err := s.users.GetRoleByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if role >= models.ADMIN {
+		return nil
+	}
+	uid, err := s.users.GetIdByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	creator, err := s.brands.GetBrandCreator(ctx, brandId)
+	if err != nil {
+		return err
+	}
+	if uid != creator {
+		return db.ERRNOPERM
+	}
+	return nil
+}
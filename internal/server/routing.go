@@ -1,43 +1,121 @@
 package server
 
 import (
-	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"accelerator/internal/db"
 	"accelerator/internal/session"
 	"accelerator/models"
 	"github.com/gofiber/fiber/v2"
-	"github.com/tarantool/go-tarantool/v2/datetime"
-	"golang.org/x/crypto/bcrypt"
 )
 
+type loginResponse struct {
+	session.Session
+	Verified bool `json:"verified"`
+}
+
 func (s *Server) SetupRouting() {
+	s.conn.Use(s.withDeadline)
 	s.conn.Get("/hemlo", func(c *fiber.Ctx) error {
 		return c.SendString("hemlo!")
 	})
-	s.conn.Get("/api/brands/open", func(c *fiber.Ctx) error { // api/brands/open?offset=x&limit=y
-		offset, _ := strconv.Atoi(c.Params("offset", "0"))
-		limit, _ := strconv.Atoi(c.Params("limit", "30"))
-		brands, err := s.db.GetOpenBrands()
+	s.conn.Get("/api/brands/open", func(c *fiber.Ctx) error { // api/brands/open?cursor=x&limit=y&total=true&facets=true, filters see parseBrandFilter
+		filter, err := parseBrandFilter(c)
 		if err != nil {
-			s.log.Errorln(err)
-			return c.SendStatus(http.StatusInternalServerError)
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		after, err := decodeCursor(c.Query("cursor"))
+		if err != nil || (after.Id > 0 && after.Sort != filter.Sort) {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		limit := pageLimit(c.Query("limit"))
+		brands, next, err := s.brands.GetOpenBrands(c.UserContext(), &filter, models.BrandCursor{Id: after.Id, Key: after.Key}, limit)
+		if errors.Is(err, db.ERRBADSORT) {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		page := models.BrandPage{Items: brands}
+		if next != nil {
+			page.NextCursor = cursor{Id: next.Id, Key: next.Key, Sort: filter.Sort}.encode()
 		}
-		var tosend []models.Brand
-		for i := range brands {
-			if i >= offset && i < limit+offset { // in [offset; limit + offset)
-				tosend = append(tosend, brands[i])
+		if c.QueryBool("total") {
+			total, err := s.brands.CountOpenBrands(c.UserContext(), &filter)
+			if err != nil {
+				return s.sendError(c, err)
 			}
+			page.Total = &total
 		}
-		marshal, err := json.Marshal(tosend)
+		if c.QueryBool("facets") {
+			facets, err := s.brands.GetBrandFacets(c.UserContext(), &filter)
+			if err != nil {
+				return s.sendError(c, err)
+			}
+			page.Facets = &facets
+		}
+		extra, err := json.Marshal(models.BrandPage{NextCursor: page.NextCursor, Total: page.Total, Facets: page.Facets})
 		if err != nil {
-			s.log.Errorln(err)
-			return c.SendStatus(http.StatusInternalServerError)
+			return s.sendError(c, err)
+		}
+		etag := listETag(brands, string(extra))
+		c.Set(fiber.HeaderETag, etag)
+		if noneMatch(c, etag) {
+			return c.SendStatus(http.StatusNotModified)
+		}
+		marshal, err := json.Marshal(page)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		return c.Send(marshal)
+	})
+	s.conn.Get("/api/brands/search", func(c *fiber.Ctx) error { // api/brands/search?q=x&cursor=y&limit=z
+		query := strings.TrimSpace(c.Query("q"))
+		if query == "" {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		after, err := decodeCursor(c.Query("cursor"))
+		if err != nil {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		limit := pageLimit(c.Query("limit"))
+		hits, more, err := s.brands.SearchBrands(c.UserContext(), query, after.Offset, limit)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		page := models.SearchPage{Items: hits}
+		if more {
+			page.NextCursor = cursor{Offset: after.Offset + len(hits)}.encode()
+		}
+		marshal, err := json.Marshal(page)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		return c.Send(marshal)
+	})
+	s.conn.Get("/api/brands/suggest", func(c *fiber.Ctx) error { // api/brands/suggest?prefix=x&limit=y
+		prefix := strings.TrimSpace(c.Query("prefix"))
+		if prefix == "" {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		limit := c.QueryInt("limit", defaultSuggestLimit)
+		if limit <= 0 || limit > maxSuggestLimit {
+			limit = defaultSuggestLimit
+		}
+		suggestions, err := s.brands.SuggestNames(c.UserContext(), prefix, limit)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		marshal, err := json.Marshal(suggestions)
+		if err != nil {
+			return s.sendError(c, err)
 		}
 		return c.Send(marshal)
 	})
@@ -48,10 +126,13 @@ func (s *Server) SetupRouting() {
 			s.log.Errorln(err)
 			return c.SendStatus(http.StatusBadRequest)
 		}
-		err = s.db.CreateUser(req)
+		err = s.users.CreateUser(c.UserContext(), req)
 		if err != nil {
+			return s.sendError(c, err)
+		}
+		err = s.sendVerification(req.Email)
+		if err != nil { // the account is there already, the link can be resent later
 			s.log.Errorln(err)
-			return c.SendStatus(http.StatusInternalServerError)
 		}
 		return c.SendStatus(http.StatusOK)
 	})
@@ -62,123 +143,140 @@ func (s *Server) SetupRouting() {
 			s.log.Errorln(err)
 			return c.SendStatus(http.StatusBadRequest)
 		}
-		actualpassword, err := s.db.GetPasswordByEmail(req.Email)
+		emailKey, ipKey := emailAttemptsKey(req.Email), ipAttemptsKey(c.IP())
+		for _, key := range []string{emailKey, ipKey} {
+			wait, err := s.guard.retryAfter(c.UserContext(), key)
+			if err != nil {
+				return s.sendError(c, err)
+			}
+			if wait > 0 {
+				c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				return c.SendStatus(http.StatusTooManyRequests)
+			}
+		}
+		isGood, err := s.users.CheckPassword(c.UserContext(), req.Email, req.Password)
 		if err != nil {
-			s.log.Errorln(err)
-			return c.SendStatus(http.StatusInternalServerError)
+			return s.sendError(c, err)
 		}
-		isGood := bcrypt.CompareHashAndPassword([]byte(actualpassword), []byte(req.Password))
-		if isGood != nil {
+		if !isGood {
+			err = s.guard.fail(c.UserContext(), emailKey, s.loginMaxAttempts)
+			if err != nil {
+				s.log.Errorln(err)
+			}
+			err = s.guard.fail(c.UserContext(), ipKey, s.loginMaxIpAttempts)
+			if err != nil {
+				s.log.Errorln(err)
+			}
 			return c.SendStatus(http.StatusForbidden)
 		}
-		newsession := session.NewSession(time.Now().Add(s.sessionLen), req.Email)
-		// apparently tarantool hates "local" timezones, so we'll just make everything the same - no timezone
-		newsession.ExpTime = newsession.ExpTime.In(time.FixedZone(datetime.NoTimezone, 0))
-		err = s.scash.StoreSession(&newsession)
+		// only the email is forgiven, otherwise one good account would let an ip keep guessing others
+		err = s.guard.reset(c.UserContext(), emailKey)
 		if err != nil {
 			s.log.Errorln(err)
-			return c.SendStatus(http.StatusInternalServerError)
 		}
-		marshal, err := json.Marshal(newsession)
+		newsession := session.NewSession(cashTime(time.Now().Add(s.sessionLen)), req.Email)
+		err = s.scash.StoreSession(c.UserContext(), &newsession)
 		if err != nil {
-			s.log.Errorln(err)
-			return c.SendStatus(http.StatusInternalServerError)
+			return s.sendError(c, err)
+		}
+		verified, err := s.users.IsVerified(c.UserContext(), req.Email)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		// unverified users can log in, they just can't add brands until they confirm the email
+		marshal, err := json.Marshal(loginResponse{Session: newsession, Verified: verified})
+		if err != nil {
+			return s.sendError(c, err)
 		}
 		return c.Send(marshal)
 	})
-	s.conn.Get("/api/users/checklogin", func(c *fiber.Ctx) error {
-		req, ok := c.GetReqHeaders()["Authorization"]
-		if ok == false {
-			return c.SendString("false")
+	s.conn.Get("/api/users/checklogin", s.requireSession, func(c *fiber.Ctx) error {
+		return c.SendString("true")
+	})
+	s.conn.Post("/api/users/logout", s.requireSession, func(c *fiber.Ctx) error {
+		err := s.scash.DeleteSession(c.UserContext(), currentSession(c).Token)
+		if err != nil {
+			return s.sendError(c, err)
 		}
-		status, err := s.isSessionActive(req[0])
-		switch status {
-		case NOTFOUND:
-			s.log.Errorln(err)
-			return c.SendStatus(http.StatusBadRequest)
-		case EXPIRED:
-			err = s.scash.DeleteSession(req[0])
-			if err != nil {
-				s.log.Errorln(err)
-			}
-			return c.SendString("false")
-		default:
-			return c.SendString("true")
+		return c.SendStatus(http.StatusOK)
+	})
+	s.conn.Post("/api/users/logout_all", s.requireSession, func(c *fiber.Ctx) error {
+		err := s.scash.DeleteSessionsByEmail(c.UserContext(), currentSession(c).Email)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		return c.SendStatus(http.StatusOK)
+	})
+	s.conn.Post("/api/users/refresh", s.requireSession, func(c *fiber.Ctx) error {
+		old := currentSession(c)
+		// the new token inherits the login time, otherwise refreshing would get around session_max_len
+		newsession := session.NewSession(old.ExpTime, old.Email)
+		newsession.CreatedTime = old.CreatedTime
+		if s.sessionMaxLen > 0 && !old.CreatedTime.IsZero() {
+			newsession.ExpTime = s.sessionExpiry(&old)
+		}
+		err := s.scash.StoreSession(c.UserContext(), &newsession)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		err = s.scash.DeleteSession(c.UserContext(), old.Token)
+		if err != nil {
+			return s.sendError(c, err)
 		}
+		marshal, err := json.Marshal(newsession)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		return c.Send(marshal)
 	})
-	s.conn.Post("/api/users/brands/add", func(c *fiber.Ctx) error {
+	s.conn.Post("/api/users/brands/add", s.requireSession, s.requireVerified, func(c *fiber.Ctx) error {
 		var req models.Brand
 		err := json.Unmarshal(c.Body(), &req)
 		if err != nil {
 			s.log.Errorln(err)
 			return c.SendStatus(http.StatusBadRequest)
 		}
-		stoken, ok := c.GetReqHeaders()["Authorization"]
-		if ok != true {
-			return c.SendStatus(http.StatusBadRequest)
+		if req.Status != models.DRAFT { // drafts wait until they're submitted, everything else goes to moderators
+			req.Status = models.PENDING
 		}
-		status, err := s.isSessionActive(stoken[0])
-		switch status {
-		case NOTFOUND:
-			s.log.Errorln(err)
-			return c.SendStatus(http.StatusBadRequest)
-		case EXPIRED:
-			err = s.scash.DeleteSession(stoken[0])
-			if err != nil {
-				s.log.Errorln(err)
-			}
-			return c.SendStatus(http.StatusForbidden)
-		}
-		req.IsOpen = true
-		ctx := context.Background()
-		ses, err := s.scash.FindSession(stoken[0])
+		req.Reason = ""
+		err = s.brands.AddBrand(c.UserContext(), &req, currentSession(c).Email)
 		if err != nil {
-			return c.SendStatus(http.StatusInternalServerError)
-		}
-		err = s.db.AddBrand(ctx, &req, ses.Email)
-		if err != nil {
-			s.log.Errorln(err)
-			return c.SendStatus(http.StatusInternalServerError)
+			return s.sendError(c, err)
 		}
 		return c.SendStatus(http.StatusOK)
 	})
-	s.conn.Post("/api/users/brands/edit", func(c *fiber.Ctx) error {
-		stoken, ok := c.GetReqHeaders()["Authorization"]
-		if ok != true {
-			return c.SendStatus(http.StatusBadRequest)
-		}
-		status, err := s.isSessionActive(stoken[0])
-		switch status {
-		case NOTFOUND:
-			s.log.Errorln(err)
-			return c.SendStatus(http.StatusBadRequest)
-		case EXPIRED:
-			err = s.scash.DeleteSession(stoken[0])
-			if err != nil {
-				s.log.Errorln(err)
-			}
-			return c.SendStatus(http.StatusForbidden)
-		}
+	s.conn.Post("/api/users/brands/edit", s.requireSession, func(c *fiber.Ctx) error {
 		var req models.Brand // just id, old values and new values in all fields that should be updated\
-		err = json.Unmarshal(c.Body(), &req)
+		err := json.Unmarshal(c.Body(), &req)
 		if err != nil {
 			s.log.Errorln(err)
 			return c.SendStatus(http.StatusBadRequest)
 		}
-		ctx := context.Background()
-		ses, err := s.scash.FindSession(stoken[0])
+		err = s.authorizeBrandEdit(c.UserContext(), currentSession(c).Email, req.Id)
 		if err != nil {
-			return c.SendStatus(http.StatusInternalServerError)
+			return s.sendBrandAccessError(c, err)
 		}
-		err = s.db.UpdateBrand(ctx, &req, ses.Email)
-		if errors.Is(err, db.ERRNOPERM) {
-			s.log.Errorln(err)
-			return c.SendStatus(http.StatusForbidden)
+		version, ok := ifMatchVersion(c)
+		if !ok {
+			return c.SendStatus(http.StatusPreconditionFailed)
 		}
+		req.Version = version
+		keepStatus, err := s.editKeepsStatus(c.UserContext(), currentSession(c).Email, req.Id)
 		if err != nil {
-			s.log.Errorln(err)
-			return c.SendStatus(http.StatusInternalServerError)
+			return s.sendLookupError(c, err)
+		}
+		err = s.brands.UpdateBrand(c.UserContext(), &req, currentSession(c).Email, keepStatus)
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.SendStatus(http.StatusNotFound)
+		}
+		if errors.Is(err, db.ERRSTALE) {
+			return c.SendStatus(http.StatusPreconditionFailed)
 		}
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		c.Set(fiber.HeaderETag, brandETag(req.Version))
 		return c.SendStatus(http.StatusOK)
 	})
 	s.conn.Get("/api/brands/get_brand_by_id", func(c *fiber.Ctx) error {
@@ -187,62 +285,91 @@ func (s *Server) SetupRouting() {
 			s.log.Errorln(err)
 			return c.SendStatus(http.StatusBadRequest)
 		}
-		brand, err := s.db.GetBrandById(params)
+		// the version is checked first, so that polling clients don't make us read all the images
+		version, status, err := s.brands.GetBrandVersion(c.UserContext(), params)
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.SendStatus(http.StatusNotFound)
+		}
 		if err != nil {
-			s.log.Errorln(err)
-			return c.SendStatus(http.StatusInternalServerError)
+			return s.sendError(c, err)
+		}
+		if status != models.PUBLISHED {
+			visible, err := s.canSeeUnpublished(c, params)
+			if err != nil {
+				return s.sendError(c, err)
+			}
+			if !visible { // the same as a missing one, ids are sequential and shouldn't tell what is under review
+				return c.SendStatus(http.StatusNotFound)
+			}
+		}
+		if noneMatch(c, brandETag(version)) {
+			c.Set(fiber.HeaderETag, brandETag(version))
+			return c.SendStatus(http.StatusNotModified)
+		}
+		brand, err := s.brands.GetBrandById(c.UserContext(), params)
+		if err != nil {
+			return s.sendError(c, err)
 		}
 		marshal, err := json.Marshal(brand)
 		if err != nil {
-			s.log.Errorln(err)
-			return c.SendStatus(http.StatusInternalServerError)
+			return s.sendError(c, err)
 		}
+		c.Set(fiber.HeaderETag, brandETag(brand.Version))
 		return c.Send(marshal)
 	})
 	s.conn.Get("/api/brands/get_brand_by_name", func(c *fiber.Ctx) error {
 		params := c.Query("name", "")
-		id, err := s.db.GetBrandIdByName(params)
+		id, err := s.brands.GetBrandIdByName(c.UserContext(), params)
 		if id == -1 {
 			return c.SendStatus(http.StatusBadRequest)
 		}
 		if err != nil {
-			s.log.Errorln(err)
-			return c.SendStatus(http.StatusInternalServerError)
+			return s.sendError(c, err)
 		}
 		return c.SendString(strconv.Itoa(id))
 	})
-	s.conn.Get("/api/users/get_added_brands", func(c *fiber.Ctx) error {
-		token, ok := c.GetReqHeaders()["Authorization"]
-		if ok == false {
-			return c.SendStatus(http.StatusForbidden)
+	s.conn.Get("/api/users/get_added_brands", s.requireSession, func(c *fiber.Ctx) error {
+		res, err := s.brands.GetBrandsAddedByUser(c.UserContext(), currentSession(c).Email)
+		if err != nil {
+			return s.sendError(c, err)
 		}
-		status, err := s.isSessionActive(token[0])
-		switch status {
-		case NOTFOUND:
-			s.log.Errorln(err)
-			return c.SendStatus(http.StatusBadRequest)
-		case EXPIRED:
-			err = s.scash.DeleteSession(token[0])
-			if err != nil {
-				s.log.Errorln(err)
-			}
-			return c.SendStatus(http.StatusForbidden)
+		etag := listETag(res)
+		c.Set(fiber.HeaderETag, etag)
+		if noneMatch(c, etag) {
+			return c.SendStatus(http.StatusNotModified)
 		}
-		ses, err := s.scash.FindSession(token[0])
+		marshal, err := json.Marshal(&res)
 		if err != nil {
-			s.log.Errorln(err)
-			return c.SendStatus(http.StatusInternalServerError)
+			return s.sendError(c, err)
 		}
-		res, err := s.db.GetBrandsAddedByUser(ses.Email)
+		return c.Send(marshal)
+	})
+	s.conn.Post("/api/admin/users/set_role", s.requireSession, s.requireRole(models.ADMIN), func(c *fiber.Ctx) error {
+		var req models.RoleChange
+		err := json.Unmarshal(c.Body(), &req)
 		if err != nil {
 			s.log.Errorln(err)
-			return c.SendStatus(http.StatusInternalServerError)
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		role, ok := models.NewRole(req.Role)
+		// admins can't demote themselves, so there is always at least one left
+		if !ok || req.Email == currentSession(c).Email {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		err = s.users.SetRole(c.UserContext(), req.Email, role)
+		if errors.Is(err, db.ERRNOUSER) {
+			return c.SendStatus(http.StatusNotFound)
 		}
-		marshal, err := json.Marshal(&res)
 		if err != nil {
-			s.log.Errorln(err)
-			return c.SendStatus(http.StatusInternalServerError)
+			return s.sendError(c, err)
 		}
-		return c.Send(marshal)
+		return c.SendStatus(http.StatusOK)
 	})
+	s.setupEditorsRouting()
+	s.setupPasswordRouting()
+	s.setupVerificationRouting()
+	s.setupPatchRouting()
+	s.setupHistoryRouting()
+	s.setupModerationRouting()
+	s.setupDeleteRouting()
 }
@@ -1,25 +1,64 @@
 package server
 
 import (
+	"context"
 	"time"
 
+	"accelerator/config"
 	"accelerator/internal/db"
+	"accelerator/internal/mailer"
 	"accelerator/internal/session"
 	"accelerator/internal/sessioncash"
 	"github.com/gofiber/fiber/v2"
 	log "github.com/sirupsen/logrus"
+	"github.com/tarantool/go-tarantool/v2/datetime"
 )
 
 type Server struct {
-	conn       *fiber.App
-	log        *log.Logger
-	sessionLen time.Duration
-	db         *db.Database
-	scash      sessioncash.CashDb
+	conn               *fiber.App
+	log                *log.Logger
+	sessionLen         time.Duration
+	sessionMaxLen      time.Duration
+	users              db.UserRepository
+	brands             db.BrandRepository
+	scash              sessioncash.CashDb
+	guard              loginGuard
+	loginMaxAttempts   int
+	loginMaxIpAttempts int
+	mail               mailer.Mailer
+	publicUrl          string
+	resetLen           time.Duration
+	verifySecret       string
+	verifyLen          time.Duration
+	resendMax          int
+	queryTimeout       time.Duration
+	admins             map[string]bool
 }
 
-func NewServer(db *db.Database, cash sessioncash.CashDb, log *log.Logger, slensec int64) Server {
-	return Server{conn: fiber.New(), log: log, sessionLen: time.Duration(slensec) * time.Second, db: db, scash: cash}
+func NewServer(users db.UserRepository, brands db.BrandRepository, cash sessioncash.CashDb, mail mailer.Mailer, log *log.Logger, conf config.Config) Server {
+	admins := make(map[string]bool)
+	for _, email := range conf.Admins {
+		admins[email] = true
+	}
+	return Server{
+		conn: fiber.New(), log: log, users: users, brands: brands, scash: cash, mail: mail, publicUrl: conf.PublicUrl,
+		resetLen:      time.Duration(conf.ResetLenSec) * time.Second,
+		verifySecret:  conf.VerifySecret,
+		verifyLen:     time.Duration(conf.VerifyLenSec) * time.Second,
+		resendMax:     conf.ResendMax,
+		queryTimeout:  time.Duration(conf.QueryTimeoutSec) * time.Second,
+		sessionLen:    time.Duration(conf.SessionLenSec) * time.Second,
+		sessionMaxLen: time.Duration(conf.SessionMaxSec) * time.Second,
+		guard: loginGuard{
+			cash:       cash,
+			window:     time.Duration(conf.LoginWindowSec) * time.Second,
+			lockout:    time.Duration(conf.LoginLockoutSec) * time.Second,
+			maxLockout: time.Duration(conf.LoginMaxLockoutSec) * time.Second,
+		},
+		loginMaxAttempts:   conf.LoginMaxAttempts,
+		loginMaxIpAttempts: conf.LoginMaxIpAttempts,
+		admins:             admins,
+	}
 }
 
 func (s *Server) ListenAndServe(port string) error {
@@ -35,14 +74,41 @@ const (
 	GOOD
 )
 
-func (s *Server) isSessionActive(sId string) (SessionStatus, error) {
-	ses, err := s.scash.FindSession(sId)
+func (s *Server) isSessionActive(ctx context.Context, sId string) (session.Session, SessionStatus, error) {
+	ses, err := s.scash.FindSession(ctx, sId)
 	if err != nil {
-		return NOTFOUND, err
+		return ses, NOTFOUND, err
 	}
 	empty := session.Session{}
 	if ses == empty || ses.IsExpired() {
-		return EXPIRED, nil
+		return ses, EXPIRED, nil
+	}
+	return ses, GOOD, nil
+}
+
+// sessionExpiry gives the expiration time for a session that is used right now: session_len from now, but not past session_max_len
+func (s *Server) sessionExpiry(ses *session.Session) time.Time {
+	exp := time.Now().Add(s.sessionLen)
+	if limit := ses.CreatedTime.Add(s.sessionMaxLen); exp.After(limit) {
+		exp = limit
 	}
-	return GOOD, nil
+	return cashTime(exp)
+}
+
+// slideSession pushes the expiration time of an active session forward
+func (s *Server) slideSession(ctx context.Context, ses *session.Session) error {
+	if s.sessionMaxLen <= 0 || ses.CreatedTime.IsZero() {
+		return nil
+	}
+	exp := s.sessionExpiry(ses)
+	if !exp.After(ses.ExpTime) {
+		return nil
+	}
+	ses.ExpTime = exp
+	return s.scash.UpdateSession(ctx, ses)
+}
+
+// cashTime apparently tarantool hates "local" timezones, so we'll just make everything the same - no timezone
+func cashTime(t time.Time) time.Time {
+	return t.In(time.FixedZone(datetime.NoTimezone, 0))
 }
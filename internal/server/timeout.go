@@ -0,0 +1,36 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"accelerator/internal/db"
+	"github.com/gofiber/fiber/v2"
+)
+
+// withDeadline gives every request query_timeout for all of its trips to postgres and the session cash.
+// Handlers pass c.UserContext() on, so a slow storage makes the request fail instead of hanging it.
+// fasthttp doesn't say when a client goes away, so a request whose client is gone still runs until it's done or out of time
+func (s *Server) withDeadline(c *fiber.Ctx) error {
+	if s.queryTimeout <= 0 {
+		return c.Next()
+	}
+	ctx, cancel := context.WithTimeout(c.UserContext(), s.queryTimeout)
+	defer cancel()
+	c.SetUserContext(ctx)
+	return c.Next()
+}
+
+// sendError 504 if the storage didn't answer in time, 503 if its context was cancelled some other way, 500 for everything else
+func (s *Server) sendError(c *fiber.Ctx, err error) error {
+	s.log.Errorln(err)
+	done := c.UserContext().Err()
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(done, context.DeadlineExceeded), db.IsQueryCanceled(err):
+		return c.SendStatus(http.StatusGatewayTimeout)
+	case errors.Is(err, context.Canceled), done != nil:
+		return c.SendStatus(http.StatusServiceUnavailable)
+	}
+	return c.SendStatus(http.StatusInternalServerError)
+}
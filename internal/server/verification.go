@@ -0,0 +1,111 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"accelerator/internal/db"
+	"accelerator/internal/mailer"
+	"github.com/gofiber/fiber/v2"
+)
+
+func verifyAttemptsKey(email string) string {
+	return "verify:" + email
+}
+
+// verificationSignature the link carries email and expiration time, the signature makes sure nobody changed them
+func (s *Server) verificationSignature(email string, exp int64) string {
+	mac := hmac.New(sha256.New, []byte(s.verifySecret))
+	mac.Write([]byte(email + "|" + strconv.FormatInt(exp, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Server) sendVerification(email string) error {
+	exp := time.Now().Add(s.verifyLen).Unix()
+	query := url.Values{}
+	query.Set("email", email)
+	query.Set("exp", strconv.FormatInt(exp, 10))
+	query.Set("sig", s.verificationSignature(email, exp))
+	return s.mail.Send(mailer.Message{
+		To:      email,
+		Subject: "Confirm your email",
+		Body:    "Follow the link to confirm your email: " + s.publicUrl + "/api/users/verify?" + query.Encode(),
+	})
+}
+
+// requireVerified keeps users with unconfirmed emails out. It has to go after requireSession
+func (s *Server) requireVerified(c *fiber.Ctx) error {
+	verified, err := s.users.IsVerified(c.UserContext(), currentSession(c).Email)
+	if errors.Is(err, db.ERRNOUSER) {
+		return c.SendStatus(http.StatusUnauthorized)
+	}
+	if err != nil {
+		return s.sendError(c, err)
+	}
+	if !verified {
+		return c.SendStatus(http.StatusForbidden)
+	}
+	return c.Next()
+}
+
+func (s *Server) setupVerificationRouting() {
+	s.conn.Get("/api/users/verify", func(c *fiber.Ctx) error {
+		email := c.Query("email")
+		exp, err := strconv.ParseInt(c.Query("exp"), 10, 64)
+		if err != nil {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		sig := c.Query("sig")
+		if !hmac.Equal([]byte(sig), []byte(s.verificationSignature(email, exp))) || time.Now().Unix() > exp {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		err = s.users.SetVerified(c.UserContext(), email)
+		if errors.Is(err, db.ERRNOUSER) {
+			return c.SendStatus(http.StatusNotFound)
+		}
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		err = s.promoteAdmin(c.UserContext(), email)
+		if err != nil { // the email is confirmed anyway, the next start promotes it
+			s.log.Errorln(err)
+		}
+		return c.SendString("email confirmed")
+	})
+	s.conn.Post("/api/users/verify/resend", s.requireSession, func(c *fiber.Ctx) error {
+		email := currentSession(c).Email
+		verified, err := s.users.IsVerified(c.UserContext(), email)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		if verified {
+			return c.SendStatus(http.StatusConflict)
+		}
+		key := verifyAttemptsKey(email)
+		wait, err := s.guard.retryAfter(c.UserContext(), key)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		if wait > 0 {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return c.SendStatus(http.StatusTooManyRequests)
+		}
+		// every resend counts like a failed login would, so they get locked out the same way
+		err = s.guard.fail(c.UserContext(), key, s.resendMax)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		err = s.sendVerification(email)
+		if err != nil {
+			return s.sendError(c, err)
+		}
+		return c.SendStatus(http.StatusOK)
+	})
+}
@@ -0,0 +1,63 @@
+package session
+
+import (
+	"math"
+	"time"
+)
+
+// Attempts counts failed logins for one key, which is either an email or a client ip
+type Attempts struct {
+	Key         string
+	Failures    int
+	LockedUntil time.Time
+	ExpTime     time.Time // after this the record is forgotten and counting starts over
+}
+
+func NewAttempts(key string) Attempts {
+	return Attempts{Key: key}
+}
+
+func (a *Attempts) IsLocked() bool {
+	return a.LockedUntil.After(time.Now())
+}
+
+func (a *Attempts) IsExpired() bool {
+	return a.ExpTime.Before(time.Now())
+}
+
+// maxLockShift is how many times a lock doubles at most, the same as login_fail in tarantool has it
+const maxLockShift = 20
+
+// LockPolicy from MaxAttempts failures on, every failure locks the key for Lockout, doubled for each failure after that, up to MaxLockout.
+// A record is kept for Window after its lock, so that failing right after the lock doubles the next one
+type LockPolicy struct {
+	MaxAttempts int
+	Lockout     time.Duration
+	MaxLockout  time.Duration
+	Window      time.Duration
+}
+
+// Fail counts one more failure on top of a, which may be expired or empty
+func (p LockPolicy) Fail(a Attempts, now time.Time) Attempts {
+	if a.ExpTime.Before(now) {
+		a = NewAttempts(a.Key)
+	}
+	a.Failures++
+	a.LockedUntil = now
+	if a.Failures >= p.MaxAttempts {
+		shift := a.Failures - p.MaxAttempts
+		if shift > maxLockShift {
+			shift = maxLockShift
+		}
+		lock := p.Lockout << shift
+		if lock>>shift != p.Lockout { // overflowed, which is still as long a lock as there can be, not none
+			lock = math.MaxInt64
+		}
+		if p.MaxLockout > 0 && lock > p.MaxLockout {
+			lock = p.MaxLockout
+		}
+		a.LockedUntil = now.Add(lock)
+	}
+	a.ExpTime = a.LockedUntil.Add(p.Window)
+	return a
+}
@@ -0,0 +1,36 @@
+package session
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLockPolicyFail(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		policy   LockPolicy
+		failures int
+		want     time.Duration
+	}{
+		{"below the threshold", LockPolicy{MaxAttempts: 3, Lockout: time.Minute}, 2, 0},
+		{"first lock", LockPolicy{MaxAttempts: 3, Lockout: time.Minute}, 3, time.Minute},
+		{"doubled", LockPolicy{MaxAttempts: 3, Lockout: time.Minute}, 5, 4 * time.Minute},
+		{"up to the max", LockPolicy{MaxAttempts: 3, Lockout: time.Minute, MaxLockout: time.Hour}, 20, time.Hour},
+		{"doubling stops", LockPolicy{MaxAttempts: 1, Lockout: time.Second}, 100, time.Second << maxLockShift},
+		{"overflow without a max", LockPolicy{MaxAttempts: 1, Lockout: 1000 * time.Hour}, 100, math.MaxInt64},
+		{"overflow with a max", LockPolicy{MaxAttempts: 1, Lockout: 1000 * time.Hour, MaxLockout: 2000 * time.Hour}, 100, 2000 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAttempts("key")
+			for i := 0; i < tt.failures; i++ {
+				a = tt.policy.Fail(a, now)
+			}
+			if got := a.LockedUntil.Sub(now); got != tt.want {
+				t.Errorf("after %d failures locked for %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package session
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ResetToken lets whoever has it set a new password for the email, once
+type ResetToken struct {
+	Token   string
+	ExpTime time.Time
+	Email   string
+}
+
+func NewResetToken(expTime time.Time, email string) ResetToken {
+	return ResetToken{Token: uuid.New().String(), ExpTime: expTime, Email: email}
+}
+
+func (r *ResetToken) IsExpired() bool {
+	return r.ExpTime.Before(time.Now())
+}
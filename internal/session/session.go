@@ -11,13 +11,14 @@ type JustToken struct { // I just sometimes need only this and I don't want to u
 }
 
 type Session struct {
-	Token   string    `json:"token"`
-	ExpTime time.Time `json:"-"`
-	Email   string    `json:"-"`
+	Token       string    `json:"token"`
+	ExpTime     time.Time `json:"-"`
+	Email       string    `json:"-"`
+	CreatedTime time.Time `json:"-"` // when the user actually logged in, refreshes keep it
 }
 
 func NewSession(expTime time.Time, email string) Session {
-	return Session{Token: uuid.New().String(), ExpTime: expTime, Email: email}
+	return Session{Token: uuid.New().String(), ExpTime: expTime, Email: email, CreatedTime: time.Now().In(expTime.Location())}
 }
 
 func (s *Session) IsExpired() bool {
@@ -2,25 +2,51 @@ package sessioncash
 
 import (
 	"context"
+	"errors"
 
 	"accelerator/internal/session"
 	"github.com/tarantool/go-tarantool/v2"
 	"github.com/tarantool/go-tarantool/v2/datetime"
 )
 
+var ERRBADTUPLE = errors.New("tuple in the cash has an unexpected shape")
+
 type CashDb interface {
-	StoreSession(s *session.Session) error
-	FindSession(token string) (session.Session, error)
-	DeleteSession(token string) error
+	StoreSession(c context.Context, s *session.Session) error
+	FindSession(c context.Context, token string) (session.Session, error)
+	UpdateSession(c context.Context, s *session.Session) error
+	DeleteSession(c context.Context, token string) error
+	FindSessionsByEmail(c context.Context, email string) ([]session.Session, error)
+	DeleteSessionsByEmail(c context.Context, email string) error
+	FindAttempts(c context.Context, key string) (session.Attempts, error)
+	// FailAttempt counts one more failure for the key and locks it as p says, atomically
+	FailAttempt(c context.Context, key string, p session.LockPolicy) (session.Attempts, error)
+	DeleteAttempts(c context.Context, key string) error
+	StoreResetToken(c context.Context, r *session.ResetToken) error
+	// TakeResetToken finds the token and removes it in one go, so that it can't be used twice
+	TakeResetToken(c context.Context, token string) (session.ResetToken, error)
 }
 
 type SessionSerialized struct {
+	_msgpack    struct{} `msgpack:",asArray"`
+	Token       string
+	ExpTime     datetime.Datetime
+	Email       string
+	CreatedTime datetime.Datetime
+}
+
+type ResetTokenSerialized struct {
 	_msgpack struct{} `msgpack:",asArray"`
 	Token    string
 	ExpTime  datetime.Datetime
 	Email    string
 }
 
+const (
+	attemptsSpace = "login_attempts"
+	resetSpace    = "reset_tokens"
+)
+
 type TarantoolCashDb struct {
 	space *tarantool.Space
 	conn  *tarantool.Connection
@@ -36,30 +62,217 @@ func NewTarantoolCashDB(host, user, password, name string, opts tarantool.Opts)
 	return &TarantoolCashDb{conn: conn, space: &space}, nil
 }
 
-func (t *TarantoolCashDb) StoreSession(s *session.Session) error {
+// do sends the request and waits for the answer. The connector only says "context is done" when the request is cancelled,
+// so then the context's own error is given instead, for callers to tell a timeout from a broken cash
+func (t *TarantoolCashDb) do(c context.Context, req tarantool.Request) (*tarantool.Response, error) {
+	resp, err := t.conn.Do(req).Get()
+	if err != nil && c.Err() != nil {
+		return nil, c.Err()
+	}
+	return resp, err
+}
+
+func (t *TarantoolCashDb) StoreSession(c context.Context, s *session.Session) error {
+	dt, err := datetime.MakeDatetime(s.ExpTime)
+	if err != nil {
+		return err
+	}
+	created, err := datetime.MakeDatetime(s.CreatedTime)
+	if err != nil {
+		return err
+	}
+	toinsert := SessionSerialized{Token: s.Token, ExpTime: dt, Email: s.Email, CreatedTime: created}
+	_, err = t.do(c, tarantool.NewInsertRequest(t.space.Name).Tuple(toinsert).Context(c))
+	return err
+}
+
+// UpdateSession only moves the expiration time, everything else in a session never changes
+func (t *TarantoolCashDb) UpdateSession(c context.Context, s *session.Session) error {
+	const index = "primary"
+	const expireField = 1
 	dt, err := datetime.MakeDatetime(s.ExpTime)
 	if err != nil {
 		return err
 	}
-	toinsert := SessionSerialized{Token: s.Token, ExpTime: dt, Email: s.Email}
-	_, err = t.conn.Do(tarantool.NewInsertRequest(t.space.Name).Tuple(toinsert)).Get()
+	ops := tarantool.NewOperations().Assign(expireField, dt)
+	_, err = t.do(c, tarantool.NewUpdateRequest(t.space.Name).Index(index).Key(tarantool.StringKey{S: s.Token}).Operations(ops).Context(c))
 	return err
 }
 
-func (t *TarantoolCashDb) FindSession(token string) (session.Session, error) {
+func (t *TarantoolCashDb) FindSession(c context.Context, token string) (session.Session, error) {
 	const index = "primary"
-	resp, err := t.conn.Do(tarantool.NewSelectRequest(t.space.Name).Index(index).Iterator(tarantool.IterEq).Key(tarantool.StringKey{S: token})).Get()
-	if err != nil || len(resp.Data) < 1 || len(resp.Data[0].([]interface{})) < 3 {
+	resp, err := t.do(c, tarantool.NewSelectRequest(t.space.Name).Index(index).Iterator(tarantool.IterEq).Key(tarantool.StringKey{S: token}).Context(c))
+	if err != nil || len(resp.Data) < 1 {
 		return session.Session{}, err
 	}
-	values := resp.Data[0].([]interface{})
-	d := values[1].(datetime.Datetime)
-	res := session.Session{Token: values[0].(string), ExpTime: d.ToTime(), Email: values[2].(string)}
+	res, _ := sessionFromTuple(resp.Data[0])
 	return res, nil
 }
 
-func (t *TarantoolCashDb) DeleteSession(token string) error {
+func (t *TarantoolCashDb) FindSessionsByEmail(c context.Context, email string) ([]session.Session, error) {
+	const index = "email"
+	resp, err := t.do(c, tarantool.NewSelectRequest(t.space.Name).Index(index).Iterator(tarantool.IterEq).Key(tarantool.StringKey{S: email}).Context(c))
+	if err != nil {
+		return nil, err
+	}
+	var res []session.Session
+	for _, tuple := range resp.Data {
+		if s, ok := sessionFromTuple(tuple); ok {
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
+// DeleteSessionsByEmail email index is not unique, and tarantool deletes only by unique ones, so we go token by token
+func (t *TarantoolCashDb) DeleteSessionsByEmail(c context.Context, email string) error {
+	sessions, err := t.FindSessionsByEmail(c, email)
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		err = t.DeleteSession(c, s.Token)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sessionFromTuple unpacks {uuid, expire_time, email, created_time} as it is stored in the space, a tuple of any other shape is no session.
+// Sessions stored before created_time existed come without it and are never extended
+func sessionFromTuple(tuple interface{}) (session.Session, bool) {
+	values, ok := tuple.([]interface{})
+	if !ok || len(values) < 3 {
+		return session.Session{}, false
+	}
+	token, ok := values[0].(string)
+	if !ok {
+		return session.Session{}, false
+	}
+	exp, ok := values[1].(datetime.Datetime)
+	if !ok {
+		return session.Session{}, false
+	}
+	email, ok := values[2].(string)
+	if !ok {
+		return session.Session{}, false
+	}
+	res := session.Session{Token: token, ExpTime: exp.ToTime(), Email: email}
+	if len(values) > 3 {
+		if created, ok := values[3].(datetime.Datetime); ok {
+			res.CreatedTime = created.ToTime()
+		}
+	}
+	return res, true
+}
+
+func (t *TarantoolCashDb) DeleteSession(c context.Context, token string) error {
+	const index = "primary"
+	_, err := t.do(c, tarantool.NewDeleteRequest(t.space.Name).Index(index).Key(tarantool.StringKey{S: token}).Context(c))
+	return err
+}
+
+// FindAttempts same as with sessions, unknown key gives an empty record and no error
+func (t *TarantoolCashDb) FindAttempts(c context.Context, key string) (session.Attempts, error) {
+	const index = "primary"
+	resp, err := t.do(c, tarantool.NewSelectRequest(attemptsSpace).Index(index).Iterator(tarantool.IterEq).Key(tarantool.StringKey{S: key}).Context(c))
+	if err != nil || len(resp.Data) < 1 {
+		return session.NewAttempts(key), err
+	}
+	return attemptsFromTuple(key, resp.Data[0]), nil
+}
+
+// FailAttempt login_fail (see tarantool-docker/configuration.lua) reads, counts and stores in one transaction.
+// It takes whole seconds, which is what the config has anyway
+func (t *TarantoolCashDb) FailAttempt(c context.Context, key string, p session.LockPolicy) (session.Attempts, error) {
+	args := []interface{}{key, p.MaxAttempts, int64(p.Lockout.Seconds()), int64(p.MaxLockout.Seconds()), int64(p.Window.Seconds())}
+	resp, err := t.do(c, tarantool.NewCallRequest("login_fail").Args(args).Context(c))
+	if err != nil || len(resp.Data) < 1 {
+		return session.NewAttempts(key), err
+	}
+	return attemptsFromTuple(key, resp.Data[0]), nil
+}
+
+// attemptsFromTuple unpacks {key, failures, locked_until, expire_time}, anything else gives an empty record
+func attemptsFromTuple(key string, tuple interface{}) session.Attempts {
+	values, ok := tuple.([]interface{})
+	if !ok || len(values) < 4 {
+		return session.NewAttempts(key)
+	}
+	locked, ok := values[2].(datetime.Datetime)
+	if !ok {
+		return session.NewAttempts(key)
+	}
+	exp, ok := values[3].(datetime.Datetime)
+	if !ok {
+		return session.NewAttempts(key)
+	}
+	return session.Attempts{Key: key, Failures: toInt(values[1]), LockedUntil: locked.ToTime(), ExpTime: exp.ToTime()}
+}
+
+func (t *TarantoolCashDb) DeleteAttempts(c context.Context, key string) error {
 	const index = "primary"
-	_, err := t.conn.Do(tarantool.NewDeleteRequest(t.space.Name).Index(index).Key(tarantool.StringKey{S: token})).Get()
+	_, err := t.do(c, tarantool.NewDeleteRequest(attemptsSpace).Index(index).Key(tarantool.StringKey{S: key}).Context(c))
 	return err
 }
+
+func (t *TarantoolCashDb) StoreResetToken(c context.Context, r *session.ResetToken) error {
+	dt, err := datetime.MakeDatetime(r.ExpTime)
+	if err != nil {
+		return err
+	}
+	toinsert := ResetTokenSerialized{Token: r.Token, ExpTime: dt, Email: r.Email}
+	_, err = t.do(c, tarantool.NewInsertRequest(resetSpace).Tuple(toinsert).Context(c))
+	return err
+}
+
+// TakeResetToken delete returns the tuple it removed, which makes it find-and-remove in one request
+func (t *TarantoolCashDb) TakeResetToken(c context.Context, token string) (session.ResetToken, error) {
+	const index = "primary"
+	resp, err := t.do(c, tarantool.NewDeleteRequest(resetSpace).Index(index).Key(tarantool.StringKey{S: token}).Context(c))
+	if err != nil || len(resp.Data) < 1 {
+		return session.ResetToken{}, err
+	}
+	values, ok := resp.Data[0].([]interface{})
+	if !ok || len(values) < 3 {
+		return session.ResetToken{}, ERRBADTUPLE
+	}
+	tok, ok := values[0].(string)
+	if !ok {
+		return session.ResetToken{}, ERRBADTUPLE
+	}
+	exp, ok := values[1].(datetime.Datetime)
+	if !ok {
+		return session.ResetToken{}, ERRBADTUPLE
+	}
+	email, ok := values[2].(string)
+	if !ok {
+		return session.ResetToken{}, ERRBADTUPLE
+	}
+	return session.ResetToken{Token: tok, ExpTime: exp.ToTime(), Email: email}, nil
+}
+
+// toInt msgpack gives back the smallest integer type that fits the number, so any of them can come
+func toInt(v interface{}) int {
+	switch n := v.(type) {
+	case int8:
+		return int(n)
+	case int16:
+		return int(n)
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case uint8:
+		return int(n)
+	case uint16:
+		return int(n)
+	case uint32:
+		return int(n)
+	case uint64:
+		return int(n)
+	default:
+		return 0
+	}
+}
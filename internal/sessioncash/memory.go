@@ -0,0 +1,160 @@
+package sessioncash
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"accelerator/internal/session"
+)
+
+// MemoryCashDb keeps sessions in process memory. It doesn't survive restarts and isn't shared between instances,
+// so it is meant for local runs and tests, where spinning up tarantool is too much
+type MemoryCashDb struct {
+	mu       sync.RWMutex
+	sessions map[string]session.Session
+	attempts map[string]session.Attempts
+	resets   map[string]session.ResetToken
+}
+
+// NewMemoryCashDB creates an in-memory storage and starts sweeping expired sessions every sweepEvery until ctx is done
+func NewMemoryCashDB(ctx context.Context, sweepEvery time.Duration) CashDb {
+	m := &MemoryCashDb{sessions: make(map[string]session.Session), attempts: make(map[string]session.Attempts), resets: make(map[string]session.ResetToken)}
+	if sweepEvery > 0 {
+		go m.sweep(ctx, sweepEvery)
+	}
+	return m
+}
+
+func (m *MemoryCashDb) sweep(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.removeExpired()
+		}
+	}
+}
+
+func (m *MemoryCashDb) removeExpired() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for token, s := range m.sessions {
+		if s.IsExpired() {
+			delete(m.sessions, token)
+		}
+	}
+	for key, a := range m.attempts {
+		if a.IsExpired() {
+			delete(m.attempts, key)
+		}
+	}
+	for token, r := range m.resets {
+		if r.IsExpired() {
+			delete(m.resets, token)
+		}
+	}
+}
+
+func (m *MemoryCashDb) StoreSession(_ context.Context, s *session.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[s.Token] = *s
+	return nil
+}
+
+// FindSession behaves like the tarantool one: unknown token gives an empty session and no error
+func (m *MemoryCashDb) FindSession(_ context.Context, token string) (session.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.sessions[token], nil
+}
+
+func (m *MemoryCashDb) UpdateSession(_ context.Context, s *session.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.sessions[s.Token]
+	if !ok {
+		return nil
+	}
+	stored.ExpTime = s.ExpTime
+	m.sessions[s.Token] = stored
+	return nil
+}
+
+func (m *MemoryCashDb) DeleteSession(_ context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, token)
+	return nil
+}
+
+func (m *MemoryCashDb) FindSessionsByEmail(_ context.Context, email string) ([]session.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var res []session.Session
+	for _, s := range m.sessions {
+		if s.Email == email {
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
+func (m *MemoryCashDb) DeleteSessionsByEmail(_ context.Context, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for token, s := range m.sessions {
+		if s.Email == email {
+			delete(m.sessions, token)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryCashDb) FindAttempts(_ context.Context, key string) (session.Attempts, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	a, ok := m.attempts[key]
+	if !ok {
+		return session.NewAttempts(key), nil
+	}
+	return a, nil
+}
+
+func (m *MemoryCashDb) FailAttempt(_ context.Context, key string, p session.LockPolicy) (session.Attempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.attempts[key]
+	if !ok {
+		a = session.NewAttempts(key)
+	}
+	a = p.Fail(a, time.Now())
+	m.attempts[key] = a
+	return a, nil
+}
+
+func (m *MemoryCashDb) DeleteAttempts(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.attempts, key)
+	return nil
+}
+
+func (m *MemoryCashDb) StoreResetToken(_ context.Context, r *session.ResetToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resets[r.Token] = *r
+	return nil
+}
+
+func (m *MemoryCashDb) TakeResetToken(_ context.Context, token string) (session.ResetToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.resets[token]
+	delete(m.resets, token)
+	return r, nil
+}
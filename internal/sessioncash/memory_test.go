@@ -0,0 +1,184 @@
+package sessioncash
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"accelerator/internal/session"
+)
+
+func TestMemorySessionExpiry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryCashDB(ctx, 10*time.Millisecond)
+	live := session.NewSession(time.Now().Add(time.Hour), "live@example.com")
+	expired := session.NewSession(time.Now().Add(-time.Second), "expired@example.com")
+	for _, s := range []*session.Session{&live, &expired} {
+		err := m.StoreSession(ctx, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		found, err := m.FindSession(ctx, expired.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.Token == "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the expired session was never swept")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	found, err := m.FindSession(ctx, live.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Email != live.Email || found.IsExpired() {
+		t.Errorf("live session came back as %+v", found)
+	}
+
+	// extending goes through UpdateSession, which only touches the expiry
+	live.ExpTime = time.Now().Add(-time.Second)
+	err = m.UpdateSession(ctx, &live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err = m.FindSession(ctx, live.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found.IsExpired() {
+		t.Errorf("session moved into the past isn't expired: %+v", found)
+	}
+}
+
+func TestMemoryResetTokenTakeOnce(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryCashDB(ctx, 0)
+	r := session.NewResetToken(time.Now().Add(time.Hour), "reset@example.com")
+	err := m.StoreResetToken(ctx, &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	taken := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := m.TakeResetToken(ctx, r.Token)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if got.Email != "" {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if taken != 1 {
+		t.Errorf("token was taken %d times, want once", taken)
+	}
+
+	got, err := m.TakeResetToken(ctx, "unknown")
+	if err != nil || got.Email != "" {
+		t.Errorf("unknown token gave %+v, %v, want an empty one", got, err)
+	}
+}
+
+func TestMemoryAttemptsLockout(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryCashDB(ctx, 0)
+	p := session.LockPolicy{MaxAttempts: 3, Lockout: time.Minute, MaxLockout: 10 * time.Minute, Window: 15 * time.Minute}
+	const key = "login:someone@example.com"
+
+	var a session.Attempts
+	var err error
+	for i := 1; i < p.MaxAttempts; i++ {
+		a, err = m.FailAttempt(ctx, key, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Failures != i || a.IsLocked() {
+			t.Fatalf("after %d failures: %+v, want %d and no lock", i, a, i)
+		}
+	}
+	start := time.Now()
+	locks := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute}
+	for _, want := range locks {
+		a, err = m.FailAttempt(ctx, key, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := a.LockedUntil.Sub(start)
+		if got < want || got > want+time.Minute/2 {
+			t.Errorf("after %d failures locked for %v, want %v", a.Failures, got, want)
+		}
+	}
+	stored, err := m.FindAttempts(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Failures != a.Failures || !stored.IsLocked() {
+		t.Errorf("FindAttempts gave %+v, want %+v", stored, a)
+	}
+
+	err = m.DeleteAttempts(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err = m.FindAttempts(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Failures != 0 || stored.IsLocked() {
+		t.Errorf("attempts after DeleteAttempts: %+v, want none", stored)
+	}
+}
+
+// TestMemoryAttemptsConcurrent parallel failures for one key all have to be counted
+func TestMemoryAttemptsConcurrent(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryCashDB(ctx, 0)
+	p := session.LockPolicy{MaxAttempts: 1000, Lockout: time.Minute, Window: time.Minute}
+	const workers, each = 8, 25
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				_, err := m.FailAttempt(ctx, "ip:127.0.0.1", p)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				_, err = m.FindAttempts(ctx, "ip:127.0.0.1")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	a, err := m.FindAttempts(ctx, "ip:127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Failures != workers*each {
+		t.Errorf("counted %d failures, want %d", a.Failures, workers*each)
+	}
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// BulkValues builds the rows of a multi-row VALUES list. Values never go into the sql itself, each one becomes a $n placeholder
+// and ends up in Args, so quotes in names and such can't break anything
+type BulkValues struct {
+	casts []string
+	rows  []string
+	args  []interface{}
+}
+
+// NewBulkValues casts are for the columns, in order, "" for none. Inserts don't need them, but VALUES in UPDATE ... FROM
+// has nothing to guess the types from, so there they have to be given
+func NewBulkValues(casts ...string) *BulkValues {
+	return &BulkValues{casts: casts}
+}
+
+// Add appends one row
+func (v *BulkValues) Add(values ...interface{}) {
+	ph := make([]string, len(values))
+	for i, val := range values {
+		v.args = append(v.args, val)
+		ph[i] = "$" + strconv.Itoa(len(v.args))
+		if i < len(v.casts) && v.casts[i] != "" {
+			ph[i] += "::" + v.casts[i]
+		}
+	}
+	v.rows = append(v.rows, "("+strings.Join(ph, ", ")+")")
+}
+
+func (v *BulkValues) Len() int {
+	return len(v.rows)
+}
+
+// String the rows, comma separated, without the VALUES keyword
+func (v *BulkValues) String() string {
+	return strings.Join(v.rows, ", ")
+}
+
+func (v *BulkValues) Args() []interface{} {
+	return v.args
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// DiffBrands lists every field that differs between two versions of a brand, in json terms.
+// Children are matched by id, so a moved or edited product shows up as changed fields, not as a whole new one
+func DiffBrands(from, to *Brand) ([]FieldChange, error) {
+	a, err := toJSONValue(from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := toJSONValue(to)
+	if err != nil {
+		return nil, err
+	}
+	res := []FieldChange{}
+	diffValues("", a, b, &res)
+	return res, nil
+}
+
+func toJSONValue(v interface{}) (interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var res interface{}
+	err = json.Unmarshal(raw, &res)
+	return res, err
+}
+
+func diffValues(path string, a, b interface{}, res *[]FieldChange) {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		if bv, ok := b.(map[string]interface{}); ok {
+			diffObjects(path, av, bv, res)
+			return
+		}
+	case []interface{}:
+		if bv, ok := b.([]interface{}); ok {
+			diffArrays(path, av, bv, res)
+			return
+		}
+	}
+	if isEmptyArray(a) && isEmptyArray(b) { // nil and empty slices look different in json, but have the same in them
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		*res = append(*res, FieldChange{Path: path, From: a, To: b})
+	}
+}
+
+func isEmptyArray(v interface{}) bool {
+	arr, ok := v.([]interface{})
+	return v == nil || (ok && len(arr) == 0)
+}
+
+func diffObjects(path string, a, b map[string]interface{}, res *[]FieldChange) {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		sub := k
+		if path != "" {
+			sub = path + "." + k
+		}
+		diffValues(sub, a[k], b[k], res)
+	}
+}
+
+// diffArrays elements with an id are matched by it, the rest by position
+func diffArrays(path string, a, b []interface{}, res *[]FieldChange) {
+	byId := make(map[float64]interface{})
+	for _, v := range a {
+		if id, ok := elementId(v); ok {
+			byId[id] = v
+		}
+	}
+	var plainA, plainB []interface{}
+	for _, v := range a {
+		if _, ok := elementId(v); !ok {
+			plainA = append(plainA, v)
+		}
+	}
+	for _, v := range b {
+		id, ok := elementId(v)
+		if !ok {
+			plainB = append(plainB, v)
+			continue
+		}
+		old := byId[id] // nil for new ones, so the whole element is reported as added
+		delete(byId, id)
+		diffValues(fmt.Sprintf("%s[id=%v]", path, id), old, v, res)
+	}
+	for _, v := range a {
+		if id, ok := elementId(v); ok {
+			if _, left := byId[id]; left {
+				*res = append(*res, FieldChange{Path: fmt.Sprintf("%s[id=%v]", path, id), From: v})
+			}
+		}
+	}
+	for i := 0; i < len(plainA) || i < len(plainB); i++ {
+		var x, y interface{}
+		if i < len(plainA) {
+			x = plainA[i]
+		}
+		if i < len(plainB) {
+			y = plainB[i]
+		}
+		diffValues(fmt.Sprintf("%s[%d]", path, i), x, y, res)
+	}
+}
+
+func elementId(v interface{}) (float64, bool) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+	id, ok := obj["id"].(float64)
+	return id, ok && id != 0
+}
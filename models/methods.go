@@ -3,6 +3,8 @@ package models
 import (
 	"bytes"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"image"
 	"image/png"
 	"strconv"
@@ -35,6 +37,31 @@ func NewContactType(s string) ContactType {
 	}
 }
 
+// NewRole ok is false for anything that isn't a known role
+func NewRole(s string) (Role, bool) {
+	switch strings.ToLower(s) {
+	case "user":
+		return USER, true
+	case "moderator":
+		return MODERATOR, true
+	case "admin":
+		return ADMIN, true
+	default:
+		return USER, false
+	}
+}
+
+func (r Role) String() string {
+	switch r {
+	case MODERATOR:
+		return "moderator"
+	case ADMIN:
+		return "admin"
+	default:
+		return "user"
+	}
+}
+
 func NewContact(typeof string, link string) Contact {
 	return Contact{TypeOf: NewContactType(typeof), Link: link}
 }
@@ -81,196 +108,97 @@ func (b *Brand) AppendContact(c ...Contact) {
 	b.Contacts = append(b.Contacts, c...)
 }
 
-func (b *Brand) GetBulkInsertStatementContacts(core string) string {
-	for i := range b.Contacts {
-		core += " ("
-		core += "'" + b.Contacts[i].TypeOf.String() + "'"
-		core += ", "
-		core += "'" + b.Contacts[i].Link + "'"
-		core += "),"
-	}
-	if len(b.Contacts) > 0 {
-		core = core[:len(core)-1]
-	}
-	return core
+// statDate statistics periods are dates, the time part is dropped
+func statDate(t time.Time) string {
+	return t.Format("2006-01-02")
 }
 
-func (b *Brand) GetBulkInsertStatementOwners(core string) string { // core is 'INSERT INTO ... VALUES'
-	for i := range b.Owners {
-		core += " ("
-		core += "'" + b.Owners[i].Per.Name + "'"
-		core += ", "
-		core += "'" + b.Owners[i].Per.Surname + "'"
-		core += ", "
-		core += "'" + b.Owners[i].Per.Fathername + "'"
-		core += ", "
-		core += "'" + b.Owners[i].Per.BioInfo + "'"
-		core += "),"
-	}
-	if len(b.Owners) > 0 {
-		core = core[:len(core)-1]
-	}
-	return core
+// statValue float32 would get extra digits on the way to numeric, so it goes as the shortest string that reads back the same
+func statValue(v float32) string {
+	return strconv.FormatFloat(float64(v), 'f', -1, 32)
 }
 
-func (b *Brand) GetBulkInsertStatementStatistics(core string) string {
-	for i := range b.Statistics {
-		core += " ("
-		core += "'" + strings.Split(b.Statistics[i].StartPeriod.Format(time.RFC3339), "T")[0] + "'" // RFC3339 is practically ISO 8601 + T<time>, and I only need ISO 8601
-		core += ", "
-		core += "'" + strings.Split(b.Statistics[i].EndPeriod.Format(time.RFC3339), "T")[0] + "'"
-		core += ", "
-		core += "'" + b.Statistics[i].Name + "'"
-		core += ", "
-		core += "'" + b.Statistics[i].Description + "'"
-		core += ", "
-		core += strconv.FormatFloat(float64(b.Statistics[i].Value), 'f', -1, 32)
-		core += ", "
-		core += strconv.Itoa(b.Id)
-		core += "),"
+// GetBulkInsertStatementContacts core is 'INSERT INTO ... VALUES', the rows and their args are added to it. The same goes for the other inserts
+func (b *Brand) GetBulkInsertStatementContacts(core string) (string, []interface{}) {
+	values := NewBulkValues()
+	for _, c := range b.Contacts {
+		values.Add(c.TypeOf.String(), c.Link)
 	}
-	if len(b.Statistics) > 0 {
-		core = core[:len(core)-1]
-	}
-	return core
+	return core + " " + values.String(), values.Args()
 }
 
-func (b *Brand) GetBulkInsertStatementPrices(core string) string {
-	for i := range b.Products {
-		core += " ("
-		core += strconv.Itoa(b.Products[i].Price.LowEnd)
-		core += ", "
-		core += strconv.Itoa(b.Products[i].Price.HighEnd)
-		core += ", "
-		core += "'" + b.Products[i].Price.Currency + "'"
-		core += "),"
-	}
-	if len(b.Products) > 0 {
-		core = core[:len(core)-1]
+func (b *Brand) GetBulkInsertStatementOwners(core string) (string, []interface{}) {
+	values := NewBulkValues()
+	for _, o := range b.Owners {
+		values.Add(o.Per.Name, o.Per.Surname, o.Per.Fathername, o.Per.BioInfo)
 	}
-	return core
+	return core + " " + values.String(), values.Args()
 }
 
-func (b *Brand) GetBulkInsertStatementProducts(core string, priceIds []int) string {
-	for i := range b.Products {
-		core += " ("
-		core += "'" + b.Products[i].Name + "'"
-		core += ", "
-		core += "'" + b.Products[i].Description + "'"
-		core += ", "
-		core += strconv.Itoa(priceIds[i])
-		core += ", "
-		core += strconv.Itoa(b.Id)
-		core += "),"
+func (b *Brand) GetBulkInsertStatementStatistics(core string) (string, []interface{}) {
+	values := NewBulkValues()
+	for _, s := range b.Statistics {
+		values.Add(statDate(s.StartPeriod), statDate(s.EndPeriod), s.Name, s.Description, statValue(s.Value), b.Id)
 	}
-	if len(b.Products) > 0 {
-		core = core[:len(core)-1]
-	}
-	return core
+	return core + " " + values.String(), values.Args()
 }
 
-func (b *Brand) GetBulkUpdateStatementContacts(core string, ids []int) string { // core will be like update ... from (values ?) as ... where ...
-	stmt := ""
-	for i := range b.Contacts {
-		stmt += " ("
-		stmt += strconv.Itoa(ids[i])
-		stmt += ","
-		stmt += "'" + b.Contacts[i].TypeOf.String() + "'"
-		stmt += ","
-		stmt += "'" + b.Contacts[i].Link + "'"
-		stmt += "),"
-	}
-	if len(b.Contacts) > 0 {
-		stmt = stmt[:len(stmt)-1]
+func (b *Brand) GetBulkInsertStatementPrices(core string) (string, []interface{}) {
+	values := NewBulkValues()
+	for _, p := range b.Products {
+		values.Add(p.Price.LowEnd, p.Price.HighEnd, p.Price.Currency)
 	}
-	core = strings.Replace(core, "?", stmt, 1)
-	return core
+	return core + " " + values.String(), values.Args()
 }
 
-func (b *Brand) GetBulkUpdateStatementOwners(core string, ids []int) string { // same as in the function above
-	stmt := ""
-	for i := range b.Owners {
-		stmt += " ("
-		stmt += strconv.Itoa(ids[i])
-		stmt += ","
-		stmt += "'" + b.Owners[i].Per.Name + "'"
-		stmt += ","
-		stmt += "'" + b.Owners[i].Per.Surname + "'"
-		stmt += ","
-		stmt += "'" + b.Owners[i].Per.Fathername + "'"
-		stmt += ","
-		stmt += "'" + b.Owners[i].Per.BioInfo + "'"
-		stmt += "),"
+func (b *Brand) GetBulkInsertStatementProducts(core string, priceIds []int) (string, []interface{}) {
+	values := NewBulkValues()
+	for i, p := range b.Products {
+		values.Add(p.Name, p.Description, priceIds[i], b.Id)
 	}
-	if len(b.Owners) > 0 {
-		stmt = stmt[:len(stmt)-1]
-	}
-	core = strings.Replace(core, "?", stmt, 1)
-	return core
+	return core + " " + values.String(), values.Args()
 }
 
-func (b *Brand) GetBulkUpdateStatementPrices(core string, ids []int) string { // same format as in update contacts
-	stmt := ""
-	for i := range b.Products {
-		stmt += " ("
-		stmt += strconv.Itoa(ids[i])
-		stmt += ","
-		stmt += strconv.Itoa(b.Products[i].Price.LowEnd)
-		stmt += ","
-		stmt += strconv.Itoa(b.Products[i].Price.HighEnd)
-		stmt += ","
-		stmt += "'" + b.Products[i].Price.Currency + "'"
-		stmt += "),"
-	}
-	if len(b.Products) > 0 {
-		stmt = stmt[:len(stmt)-1]
+// GetBulkUpdateStatementContacts core will be like update ... from (values ?) as ... where ..., the rows go instead of the ?
+// and ids[i] is the id of the i-th contact. The same goes for the other updates
+func (b *Brand) GetBulkUpdateStatementContacts(core string, ids []int) (string, []interface{}) {
+	values := NewBulkValues("int", "text", "text")
+	for i, c := range b.Contacts {
+		values.Add(ids[i], c.TypeOf.String(), c.Link)
 	}
-	core = strings.Replace(core, "?", stmt, 1)
-	return core
+	return strings.Replace(core, "?", values.String(), 1), values.Args()
 }
 
-func (b *Brand) GetBulkUpdateStatementProducts(core string, ids []int) string { // see format in the previous functions...
-	stmt := ""
-	for i := range b.Products {
-		stmt += " ("
-		stmt += strconv.Itoa(ids[i])
-		stmt += ","
-		stmt += "'" + b.Products[i].Name + "'"
-		stmt += ","
-		stmt += "'" + b.Products[i].Description + "'"
-		stmt += "),"
+func (b *Brand) GetBulkUpdateStatementOwners(core string, ids []int) (string, []interface{}) {
+	values := NewBulkValues("int", "text", "text", "text", "text")
+	for i, o := range b.Owners {
+		values.Add(ids[i], o.Per.Name, o.Per.Surname, o.Per.Fathername, o.Per.BioInfo)
 	}
-	if len(b.Products) > 0 {
-		stmt = stmt[:len(stmt)-1]
+	return strings.Replace(core, "?", values.String(), 1), values.Args()
+}
+
+func (b *Brand) GetBulkUpdateStatementPrices(core string, ids []int) (string, []interface{}) {
+	values := NewBulkValues("int", "int", "int", "text")
+	for i, p := range b.Products {
+		values.Add(ids[i], p.Price.LowEnd, p.Price.HighEnd, p.Price.Currency)
 	}
-	core = strings.Replace(core, "?", stmt, 1)
-	return core
+	return strings.Replace(core, "?", values.String(), 1), values.Args()
 }
 
-func (b *Brand) GetBulkUpdateStatementStats(core string, ids []int) string {
-	stmt := ""
-	for i := range b.Statistics {
-		stmt += " ("
-		stmt += strconv.Itoa(ids[i])
-		stmt += ","
-		stmt += "'" + strings.Split(b.Statistics[i].StartPeriod.Format(time.RFC3339), "T")[0] + "'" // as in insert, RFC3339 is basically ISO 8601 + T<time>, and I need only ISO
-		stmt += "::date"                                                                            // because it refuses to work otherwise
-		stmt += ","
-		stmt += "'" + strings.Split(b.Statistics[i].EndPeriod.Format(time.RFC3339), "T")[0] + "'"
-		stmt += "::date"
-		stmt += ","
-		stmt += "'" + b.Statistics[i].Name + "'"
-		stmt += ","
-		stmt += "'" + b.Statistics[i].Description + "'"
-		stmt += ","
-		stmt += strconv.FormatFloat(float64(b.Statistics[i].Value), 'f', -1, 32)
-		stmt += "),"
+func (b *Brand) GetBulkUpdateStatementProducts(core string, ids []int) (string, []interface{}) {
+	values := NewBulkValues("int", "text", "text")
+	for i, p := range b.Products {
+		values.Add(ids[i], p.Name, p.Description)
 	}
-	if len(b.Statistics) > 0 {
-		stmt = stmt[:len(stmt)-1]
+	return strings.Replace(core, "?", values.String(), 1), values.Args()
+}
+
+func (b *Brand) GetBulkUpdateStatementStats(core string, ids []int) (string, []interface{}) {
+	values := NewBulkValues("int", "date", "date", "text", "text", "numeric")
+	for i, s := range b.Statistics {
+		values.Add(ids[i], statDate(s.StartPeriod), statDate(s.EndPeriod), s.Name, s.Description, statValue(s.Value))
 	}
-	core = strings.Replace(core, "?", stmt, 1)
-	return core
+	return strings.Replace(core, "?", values.String(), 1), values.Args()
 }
 
 func (c ContactType) String() string {
@@ -291,3 +219,40 @@ func (c ContactType) String() string {
 		return "other"
 	}
 }
+
+// Validate checks what the db won't: required names are there, prices and periods aren't upside down, contact types are known
+func (b *Brand) Validate() error {
+	if strings.TrimSpace(b.Name) == "" {
+		return errors.New("brand name is empty")
+	}
+	for _, c := range b.Contacts {
+		if c.TypeOf < _PHONE || c.TypeOf > _OTHER {
+			return fmt.Errorf("unknown contact type %d", c.TypeOf)
+		}
+		if strings.TrimSpace(c.Link) == "" {
+			return errors.New("contact link is empty")
+		}
+	}
+	for _, o := range b.Owners {
+		if strings.TrimSpace(o.Per.Name) == "" {
+			return errors.New("owner name is empty")
+		}
+	}
+	for _, s := range b.Statistics {
+		if strings.TrimSpace(s.Name) == "" {
+			return errors.New("statistic name is empty")
+		}
+		if s.EndPeriod.Before(s.StartPeriod) {
+			return fmt.Errorf("statistic %q ends before it starts", s.Name)
+		}
+	}
+	for _, p := range b.Products {
+		if strings.TrimSpace(p.Name) == "" {
+			return errors.New("product name is empty")
+		}
+		if p.Price.LowEnd < 0 || p.Price.HighEnd < p.Price.LowEnd {
+			return fmt.Errorf("product %q has a bad price range", p.Name)
+		}
+	}
+	return nil
+}
@@ -2,8 +2,21 @@ package models
 
 import "time"
 
+// History one saved revision of a brand. EditedBy is empty if the account is gone; Brand is only there when a single revision is asked for
 type History struct {
-	Id int `json:"-"`
+	Id        int       `json:"-"`
+	BrandId   int       `json:"brand_id"`
+	Version   int       `json:"version"`
+	EditedBy  string    `json:"edited_by"`
+	CreatedAt time.Time `json:"created_at"`
+	Brand     *Brand    `json:"brand,omitempty"`
+}
+
+// FieldChange path is like "products[id=3].price.lowEnd"; From is missing for added fields and To for removed ones
+type FieldChange struct {
+	Path string      `json:"path"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
 }
 
 type User struct {
@@ -13,6 +26,47 @@ type User struct {
 	Surname  string `json:"surname"`
 }
 
+// Role the order matters: every role can do everything the ones before it can
+type Role int
+
+const (
+	USER Role = iota
+	MODERATOR
+	ADMIN
+)
+
+type RoleChange struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// BrandStatus only published brands are seen by everyone
+type BrandStatus string
+
+const (
+	DRAFT     BrandStatus = "draft"
+	PENDING   BrandStatus = "pending_review"
+	PUBLISHED BrandStatus = "published"
+	REJECTED  BrandStatus = "rejected"
+	ARCHIVED  BrandStatus = "archived"
+)
+
+type ModerationDecision struct {
+	Reason string `json:"reason"`
+}
+
+type EditorChange struct {
+	BrandId int    `json:"brand_id"`
+	Email   string `json:"email,omitempty"`
+}
+
+type Editor struct {
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+	Surname  string `json:"surname"`
+	Accepted bool   `json:"accepted"`
+}
+
 type Person struct {
 	Name       string `json:"name"`
 	Surname    string `json:"surname"`
@@ -21,13 +75,13 @@ type Person struct {
 }
 
 type Owner struct {
-	Id   int       `json:"-"`
+	Id   int       `json:"id,omitempty"`
 	Per  Person    `json:"person"`
 	Hist []History `json:"history"`
 }
 
 type StatisticMeasure struct {
-	Id          int       `json:"-"`
+	Id          int       `json:"id,omitempty"`
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	StartPeriod time.Time `json:"startPeriod"`
@@ -36,14 +90,14 @@ type StatisticMeasure struct {
 }
 
 type Price struct {
-	Id       int    `json:"-"`
+	Id       int    `json:"id,omitempty"`
 	LowEnd   int    `json:"lowEnd"`
 	HighEnd  int    `json:"highEnd"`
 	Currency string `json:"currency"`
 }
 
 type Product struct {
-	Id          int      `json:"-"`
+	Id          int      `json:"id,omitempty"`
 	Name        string   `json:"name"`
 	Description string   `json:"description"`
 	Price       Price    `json:"price"`
@@ -62,6 +116,7 @@ const (
 )
 
 type Contact struct {
+	Id     int         `json:"id,omitempty"`
 	TypeOf ContactType `json:"typeOf"`
 	Link   string      `json:"link"`
 }
@@ -71,14 +126,82 @@ type Brand struct {
 	Name        string             `json:"name"`
 	Description string             `json:"description"`
 	Location    string             `json:"location"`
-	IsOpen      bool               `json:"is_open,omitempty"`
+	Status      BrandStatus        `json:"status,omitempty"`
+	Reason      string             `json:"status_reason,omitempty"` // why it was rejected
 	Owners      []Owner            `json:"owners"`
 	Contacts    []Contact          `json:"contacts"`
 	Statistics  []StatisticMeasure `json:"statistics"`
 	Products    []Product          `json:"products"`
+	Version     int                `json:"-"` // goes in the ETag header instead
+}
+
+// BrandPage next_cursor is only there if there are more brands after this page
+type BrandPage struct {
+	Items      []Brand `json:"items"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	Total      *int    `json:"total,omitempty"`
+	Facets     *Facets `json:"facets,omitempty"`
+}
+
+// BrandFilter empty fields don't filter anything. Sort is one of "name", "created", "stat", with "-" in front for descending; empty means by id
+type BrandFilter struct {
+	City     string
+	PriceMin *int
+	PriceMax *int
+	Currency string
+	Contacts []string // all of these contact types have to be there
+	HasStats *bool
+	Sort     string
+}
+
+// BrandCursor points at the last brand of a page. Key is its value of whatever brands are sorted by, as postgres prints it
+type BrandCursor struct {
+	Id  int
+	Key string
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type Facets struct {
+	Cities     []FacetCount `json:"cities"`
+	Currencies []FacetCount `json:"currencies"`
+}
+
+// SearchHit snippet is HTML: the brand's own text in it is escaped, and the matched words are wrapped in <b></b>
+type SearchHit struct {
+	Id       int     `json:"id"`
+	Name     string  `json:"name"`
+	Location string  `json:"location"`
+	Rank     float32 `json:"rank"`
+	Snippet  string  `json:"snippet"`
+}
+
+type SearchPage struct {
+	Items      []SearchHit `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// Suggestion type is "brand" or "product"; for brands brand_id is the same as id
+type Suggestion struct {
+	Type    string `json:"type"`
+	Id      int    `json:"id"`
+	Name    string `json:"name"`
+	BrandId int    `json:"brand_id"`
 }
 
 type LoginData struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
+
+type PasswordForgot struct {
+	Email string `json:"email"`
+}
+
+type PasswordReset struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
@@ -1,9 +1,66 @@
+local datetime = require('datetime')
+local fiber = require('fiber')
+
+-- login_fail counts one more failed attempt for the key and locks it once there are too many. It is one transaction,
+-- so parallel failures can't read the same count and overwrite each other. Durations are whole seconds
+function login_fail(key, max_attempts, lockout, max_lockout, window)
+    return box.atomic(function()
+        local now = datetime.now()
+        local failures = 1
+        local t = box.space.login_attempts:get(key)
+        if t ~= nil and t.expire_time > now then
+            failures = t.failures + 1
+        end
+        local locked_until = now
+        if failures >= max_attempts then
+            local lock = math.floor(lockout * 2 ^ math.min(failures - max_attempts, 20)) -- two years for a minute lockout, intervals can't be much longer
+            if max_lockout > 0 and lock > max_lockout then
+                lock = max_lockout
+            end
+            locked_until = now + datetime.interval.new({ sec = lock })
+        end
+        return box.space.login_attempts:replace({ key, failures, locked_until, locked_until + datetime.interval.new({ sec = window }) })
+    end)
+end
+
+-- sweep_expired deletes tuples of the space whose expire_time has passed, keyed by the field key.
+-- Login attempts and reset tokens that nobody comes back for are deleted by nothing else, without it those spaces only grow
+local function sweep_expired(space, key, every)
+    fiber.create(function()
+        while true do
+            fiber.sleep(every)
+            if not box.info.ro then
+                local now = datetime.now()
+                local expired = {}
+                for _, t in box.space[space]:pairs() do
+                    if t.expire_time < now then
+                        table.insert(expired, t[key])
+                    end
+                end
+                for _, k in ipairs(expired) do
+                    box.space[space]:delete(k)
+                end
+            end
+        end
+    end)
+end
+
 local function start()
-    box.schema.space.create("sessions")
-    box.space.sessions:format({ { name = "uuid", type = "string", is_nullable = false }, { name = "expire_time", type = "datetime", is_nullable = false }, { name = "email", type = "string", is_nullable = false } })
-    box.space.sessions:create_index("primary", { parts = { "uuid" } })
+    box.schema.space.create("sessions", { if_not_exists = true })
+    box.space.sessions:format({ { name = "uuid", type = "string", is_nullable = false }, { name = "expire_time", type = "datetime", is_nullable = false }, { name = "email", type = "string", is_nullable = false }, { name = "created_time", type = "datetime", is_nullable = true } })
+    box.space.sessions:create_index("primary", { parts = { "uuid" }, if_not_exists = true })
+    box.space.sessions:create_index("email", { parts = { "email" }, unique = false, if_not_exists = true })
+    box.schema.space.create("login_attempts", { if_not_exists = true })
+    box.space.login_attempts:format({ { name = "key", type = "string", is_nullable = false }, { name = "failures", type = "unsigned", is_nullable = false }, { name = "locked_until", type = "datetime", is_nullable = false }, { name = "expire_time", type = "datetime", is_nullable = false } })
+    box.space.login_attempts:create_index("primary", { parts = { "key" }, if_not_exists = true })
+    box.schema.space.create("reset_tokens", { if_not_exists = true })
+    box.space.reset_tokens:format({ { name = "token", type = "string", is_nullable = false }, { name = "expire_time", type = "datetime", is_nullable = false }, { name = "email", type = "string", is_nullable = false } })
+    box.space.reset_tokens:create_index("primary", { parts = { "token" }, if_not_exists = true })
+    box.schema.func.create("login_fail", { if_not_exists = true })
+    sweep_expired("login_attempts", "key", 60)
+    sweep_expired("reset_tokens", "token", 60)
 end
 
 return {
     start = start
-}
\ No newline at end of file
+}